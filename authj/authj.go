@@ -2,10 +2,11 @@ package authj
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/casbin/casbin/v2"
+
+	"github.com/thinkgos/http-middlewares/requestid"
 )
 
 // contextKey is a value for use with context.WithValue. It's used as
@@ -22,17 +23,11 @@ func NewAuthorizer(e casbin.IEnforcer,
 			// checks the userName,path,method permission combination from the request.
 			allowed, err := e.Enforce(subject(r), r.URL.Path, r.Method)
 			if err != nil {
-				renderJSON(w, http.StatusInternalServerError, map[string]interface{}{
-					"code":    http.StatusInternalServerError,
-					"message": "Permission validation errors occur!",
-				})
+				requestid.RenderJSONError(w, r, http.StatusInternalServerError, "Permission validation errors occur!")
 				return
 			} else if !allowed {
 				// the 403 Forbidden to the client
-				renderJSON(w, http.StatusForbidden, map[string]interface{}{
-					"code":    http.StatusForbidden,
-					"message": "Permission denied!",
-				})
+				requestid.RenderJSONError(w, r, http.StatusForbidden, "Permission denied!")
 				return
 			}
 
@@ -41,19 +36,6 @@ func NewAuthorizer(e casbin.IEnforcer,
 	}
 }
 
-func renderJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.WriteHeader(statusCode)
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	content, err := json.Marshal(data)
-	if err != nil {
-		panic(err)
-	}
-	_, err = w.Write(content)
-	if err != nil {
-		panic(err)
-	}
-}
-
 // Subject returns the value associated with this context for subjectCtxKey,
 func Subject(r *http.Request) string {
 	val, _ := r.Context().Value(ctxAuthKey{}).(string)
@@ -11,6 +11,8 @@ import (
 	"testing"
 
 	"github.com/casbin/casbin/v2"
+
+	"github.com/thinkgos/http-middlewares/requestid"
 )
 
 func testAuthzRequest(t *testing.T, next http.HandlerFunc, user, path, method string, code int) {
@@ -94,3 +96,25 @@ func TestRBAC(t *testing.T) {
 	testAuthzRequest(t, next, "cathy", "/dataset2/item", "POST", 403)
 	testAuthzRequest(t, next, "cathy", "/dataset2/item", "DELETE", 403)
 }
+
+func TestForbiddenBody(t *testing.T) {
+	e, _ := casbin.NewEnforcer("authj_model.conf", "authj_policy.csv")
+
+	h := requestid.RequestID(requestid.WithNextRequestID(func() string { return "req-1" }))(
+		NewAuthorizer(e, func(*http.Request) string { return "alice" })(
+			func(http.ResponseWriter, *http.Request) {}))
+	r, _ := http.NewRequestWithContext(context.TODO(), "POST", "/dataset1/resource2", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("code = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("content type = %q", ct)
+	}
+	want := `{"code":403,"message":"Permission denied!","request_id":"req-1"}`
+	if body := w.Body.String(); body != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+}
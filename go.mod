@@ -7,4 +7,5 @@ require (
 	github.com/didip/tollbooth/v6 v6.1.0
 	github.com/go-chi/chi/v5 v5.0.3
 	go.uber.org/zap v1.16.0
+	gopkg.in/yaml.v3 v3.0.1
 )
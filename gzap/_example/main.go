@@ -22,9 +22,11 @@ func main() {
 	//   - Logs to stdout.
 	//   - RFC3339 with UTC time format.
 	//   - Custom zap field
+	//   - Extra response size, protocol and route fields
 	r.Use(gzap.Logger(logger,
 		gzap.WithTimeFormat(time.RFC3339),
 		gzap.WithUTC(true),
+		gzap.WithExtraFields(gzap.FieldBytesWritten|gzap.FieldProto|gzap.FieldRoute),
 		gzap.WithCustomFields(
 			func(r *http.Request) zap.Field { return zap.String("custom field1", mids.ClientIP(r)) },
 			func(r *http.Request) zap.Field { return zap.String("custom field2", mids.ClientIP(r)) },
@@ -34,7 +36,9 @@ func main() {
 	// Logs all panic to error log
 	//   - stack means whether output the stack info.
 	//   - Custom zap field
+	//   - Render a json body for panic
 	r.Use(gzap.Recovery(logger, true,
+		gzap.WithPanicResponder(gzap.JSONPanicResponder),
 		gzap.WithCustomFields(
 			func(r *http.Request) zap.Field { return zap.String("custom field1", mids.ClientIP(r)) },
 			func(r *http.Request) zap.Field { return zap.String("custom field2", mids.ClientIP(r)) },
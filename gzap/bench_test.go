@@ -0,0 +1,49 @@
+package gzap
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newBenchLogger() *zap.Logger {
+	return zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(ioutil.Discard),
+		zapcore.InfoLevel,
+	))
+}
+
+func benchmarkLogger(b *testing.B, opts ...Option) {
+	h := Logger(newBenchLogger(), opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/ping?a=1", nil)
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkLogger(b *testing.B) {
+	benchmarkLogger(b)
+}
+
+func BenchmarkLoggerOmitTime(b *testing.B) {
+	benchmarkLogger(b, WithOmitTime(true))
+}
+
+func BenchmarkLoggerExtraFields(b *testing.B) {
+	benchmarkLogger(b, WithOmitTime(true), WithExtraFields(FieldAll))
+}
+
+func BenchmarkLoggerCommonLogFormat(b *testing.B) {
+	benchmarkLogger(b, WithFormatter(CommonLogFormat), WithWriter(ioutil.Discard))
+}
@@ -0,0 +1,97 @@
+package gzap
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// ctxAccumulatorKey is the context key of the accumulator which installed by Logger.
+type ctxAccumulatorKey struct{}
+
+// accumulator accumulates the fields and errors added by the downstream handlers.
+// It is also the request context itself, which saves an allocation of context.WithValue.
+type accumulator struct {
+	context.Context
+	mu     sync.Mutex
+	fields []zap.Field
+	errs   []error
+}
+
+func newAccumulatorContext(ctx context.Context) (context.Context, *accumulator) {
+	acc := &accumulator{Context: ctx}
+	return acc, acc
+}
+
+// Value implement context.Context interface.
+func (acc *accumulator) Value(key interface{}) interface{} {
+	if key == (ctxAccumulatorKey{}) {
+		return acc
+	}
+	return acc.Context.Value(key)
+}
+
+func fromAccumulator(ctx context.Context) *accumulator {
+	acc, _ := ctx.Value(ctxAccumulatorKey{}).(*accumulator)
+	return acc
+}
+
+// AddFields adds the fields to the access log entry of the request,
+// which is written by Logger after the handler returns.
+// ctx must be the request context (or derived from it) under Logger,
+// otherwise the fields are discarded.
+// It is safe for concurrent use.
+func AddFields(ctx context.Context, fields ...zap.Field) {
+	if acc := fromAccumulator(ctx); acc != nil {
+		acc.mu.Lock()
+		acc.fields = append(acc.fields, fields...)
+		acc.mu.Unlock()
+	}
+}
+
+// SetError records the error to the access log entry of the request,
+// the entry is logged with zap.Errors("errors", ...) at error level.
+// It can be called multiple times, and nil error is ignored.
+// r must be the request (or derived from it) under Logger, otherwise the error is discarded.
+// It is safe for concurrent use.
+func SetError(r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+	if acc := fromAccumulator(r.Context()); acc != nil {
+		acc.mu.Lock()
+		acc.errs = append(acc.errs, err)
+		acc.mu.Unlock()
+	}
+}
+
+// Errors returns the errors recorded by SetError of the request.
+func Errors(r *http.Request) []error {
+	acc := fromAccumulator(r.Context())
+	if acc == nil {
+		return nil
+	}
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	return append([]error(nil), acc.errs...)
+}
+
+// hasErrors reports whether any error recorded.
+func (acc *accumulator) hasErrors() bool {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	return len(acc.errs) > 0
+}
+
+// appendFields appends the accumulated fields to fields.
+func (acc *accumulator) appendFields(fields []zap.Field) []zap.Field {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	fields = append(fields, acc.fields...)
+	if len(acc.errs) > 0 {
+		fields = append(fields, zap.Errors("errors", acc.errs))
+	}
+	return fields
+}
@@ -0,0 +1,281 @@
+package gzap
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/thinkgos/http-middlewares/requestid"
+)
+
+// ExtraField optional access log field, which can be combined with bitwise or.
+type ExtraField uint
+
+// optional access log fields
+const (
+	// FieldBytesWritten response body bytes written, key "bytes-written"
+	FieldBytesWritten ExtraField = 1 << iota
+	// FieldContentLength request content length, key "content-length"
+	FieldContentLength
+	// FieldBytesRead request body bytes actually read by handler, key "bytes-read"
+	FieldBytesRead
+	// FieldProto request protocol version, key "proto"
+	FieldProto
+	// FieldHost request host, key "host"
+	FieldHost
+	// FieldScheme request scheme, http or https, key "scheme"
+	FieldScheme
+	// FieldTLS tls version and cipher suite, key "tls-version" and "tls-cipher"
+	FieldTLS
+	// FieldRoute chi route pattern, key "route"
+	FieldRoute
+
+	// FieldAll all the optional fields
+	FieldAll = FieldBytesWritten | FieldContentLength | FieldBytesRead |
+		FieldProto | FieldHost | FieldScheme | FieldTLS | FieldRoute
+)
+
+// Has reports whether f contains field.
+func (f ExtraField) Has(field ExtraField) bool { return f&field != 0 }
+
+// Entry an access log entry, which extract from the request and response.
+type Entry struct {
+	// Time request finish time, in UTC if WithUTC(true)
+	Time time.Time
+	// Latency request latency
+	Latency time.Duration
+	// Status response status code
+	Status int
+	// Method request method
+	Method string
+	// Path request path before the handler
+	Path string
+	// Query request raw query before the handler
+	Query string
+	// IP client ip
+	IP string
+	// User basic auth user name, empty if not present
+	User string
+	// UserAgent request user agent
+	UserAgent string
+	// Referer request referer
+	Referer string
+	// BytesWritten response body bytes written
+	BytesWritten int
+	// ContentLength request content length, -1 means unknown
+	ContentLength int64
+	// BytesRead request body bytes actually read by handler,
+	// only valid when FieldBytesRead set
+	BytesRead int64
+	// Proto request protocol version, like "HTTP/1.1"
+	Proto string
+	// Host request host
+	Host string
+	// Scheme request scheme, http or https
+	Scheme string
+	// TLS request tls connection state, nil if not tls
+	TLS *tls.ConnectionState
+	// Route chi route pattern, empty if not route by chi
+	Route string
+	// Upgraded whether the connection is upgraded (like websocket) or hijacked,
+	// the Status is 101 Switching Protocols.
+	Upgraded bool
+}
+
+// entryPool the pool of the access log entry, reduce the allocation per request.
+var entryPool = sync.Pool{
+	New: func() interface{} { return new(Entry) },
+}
+
+func putEntry(e *Entry) {
+	*e = Entry{}
+	entryPool.Put(e)
+}
+
+// newEntry extract the access log entry from the request and response.
+func newEntry(cfg *Config, r *http.Request, ww middleware.WrapResponseWriter,
+	body *bodyReader, start time.Time, path, query string) *Entry {
+	end := time.Now()
+	latency := end.Sub(start)
+	if cfg.utc {
+		end = end.UTC()
+	}
+	user, _, _ := r.BasicAuth()
+	e := entryPool.Get().(*Entry)
+	*e = Entry{
+		Time:          end,
+		Latency:       latency,
+		Status:        ww.Status(),
+		Method:        r.Method,
+		Path:          path,
+		Query:         query,
+		IP:            cfg.clientIP(r),
+		User:          user,
+		UserAgent:     r.UserAgent(),
+		Referer:       r.Referer(),
+		BytesWritten:  ww.BytesWritten(),
+		ContentLength: r.ContentLength,
+		Proto:         r.Proto,
+		Host:          r.Host,
+		Scheme:        scheme(r),
+		TLS:           r.TLS,
+	}
+	if body != nil {
+		e.BytesRead = body.n
+	}
+	// the hijacked connection writes the status directly to the connection,
+	// so the status is not recorded.
+	if e.Status == http.StatusSwitchingProtocols || (e.Status == 0 && isUpgrade(r)) {
+		e.Status = http.StatusSwitchingProtocols
+		e.Upgraded = true
+	}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		e.Route = rctx.RoutePattern()
+	}
+	return e
+}
+
+// appendFields append the entry fields and the optional fields which the extra contain,
+// the "time" field is omitted if timeFormat is empty.
+func (e *Entry) appendFields(fields []zap.Field, timeFormat string, extra ExtraField) []zap.Field {
+	fields = append(fields,
+		zap.Int("status", e.Status),
+		zap.String("method", e.Method),
+		zap.String("path", e.Path),
+		zap.String("query", e.Query),
+		zap.String("ip", e.IP),
+		zap.String("user-agent", e.UserAgent),
+	)
+	if timeFormat != "" {
+		fields = append(fields, zap.String("time", e.Time.Format(timeFormat)))
+	}
+	fields = append(fields, zap.Duration("latency", e.Latency))
+	if extra.Has(FieldBytesWritten) {
+		fields = append(fields, zap.Int("bytes-written", e.BytesWritten))
+	}
+	if extra.Has(FieldContentLength) {
+		fields = append(fields, zap.Int64("content-length", e.ContentLength))
+	}
+	if extra.Has(FieldBytesRead) {
+		fields = append(fields, zap.Int64("bytes-read", e.BytesRead))
+	}
+	if extra.Has(FieldProto) {
+		fields = append(fields, zap.String("proto", e.Proto))
+	}
+	if extra.Has(FieldHost) {
+		fields = append(fields, zap.String("host", e.Host))
+	}
+	if extra.Has(FieldScheme) {
+		fields = append(fields, zap.String("scheme", e.Scheme))
+	}
+	if extra.Has(FieldTLS) && e.TLS != nil {
+		fields = append(fields,
+			zap.String("tls-version", tlsVersionName(e.TLS.Version)),
+			zap.String("tls-cipher", tls.CipherSuiteName(e.TLS.CipherSuite)),
+		)
+	}
+	if extra.Has(FieldRoute) {
+		fields = append(fields, zap.String("route", e.Route))
+	}
+	if e.Upgraded {
+		fields = append(fields, zap.Bool("upgraded", true))
+	}
+	return fields
+}
+
+// requestFields returns the request fields which are known before the handler.
+func requestFields(cfg *Config, r *http.Request, path, query string) []zap.Field {
+	return []zap.Field{
+		zap.String("method", r.Method),
+		zap.String("path", path),
+		zap.String("query", query),
+		zap.String("ip", cfg.clientIP(r)),
+		zap.String("user-agent", r.UserAgent()),
+	}
+}
+
+// headerFields the request headers to log.
+type headerFields struct {
+	header http.Header
+	names  []string
+}
+
+// MarshalLogObject implement zapcore.ObjectMarshaler interface.
+func (h headerFields) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, name := range h.names {
+		if v := h.header[name]; len(v) > 0 {
+			enc.AddString(name, strings.Join(v, ", "))
+		}
+	}
+	return nil
+}
+
+// isUpgrade reports whether the request asks for a protocol upgrade, like websocket.
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bodyReader counts the bytes read from the request body.
+type bodyReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04X", version)
+	}
+}
+
+// newCorrelationID returns the request id if present, otherwise a random id.
+func newCorrelationID(r *http.Request) string {
+	if id := requestid.FromRequestID(r.Context()); id != "" {
+		return id
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
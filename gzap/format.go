@@ -0,0 +1,178 @@
+package gzap
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// clfTimeFormat the time format of the Apache/NCSA common log format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// Formatter format an access log entry to a single line.
+// The entry is reused after Format returns, it must not be retained.
+type Formatter interface {
+	Format(e *Entry) string
+}
+
+// FormatterFunc is an adapter to allow the use of ordinary functions as Formatter.
+type FormatterFunc func(e *Entry) string
+
+// Format implement Formatter interface.
+func (f FormatterFunc) Format(e *Entry) string { return f(e) }
+
+// CommonLogFormat Apache/NCSA common log format.
+//
+//	%h %l %u %t "%r" %>s %b
+//
+// like:
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+var CommonLogFormat Formatter = FormatterFunc(func(e *Entry) string {
+	return string(appendCommon(make([]byte, 0, 128), e))
+})
+
+// CombinedLogFormat Apache/NCSA combined log format.
+//
+//	%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+//
+// like:
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"
+var CombinedLogFormat Formatter = FormatterFunc(func(e *Entry) string {
+	b := appendCommon(make([]byte, 0, 256), e)
+	b = append(b, ' ')
+	b = appendQuoted(b, e.Referer)
+	b = append(b, ' ')
+	b = appendQuoted(b, e.UserAgent)
+	return string(b)
+})
+
+// NewTemplateFormatter returns a Formatter which render the entry with text/template.
+// The template data is *Entry, and the following functions are available:
+//
+//	clftime: format time in common log format, like {{clftime .Time}}
+//	dash: escaped string, "-" if the string is empty, like {{dash .User}}
+//	quote: double-quoted and escaped string, like {{quote .UserAgent}}
+//	request: the escaped request line, like {{request .}}
+//	status: the status code, 0 is reported as 200, like {{status .Status}}
+//
+// The control characters, non-ASCII bytes, '"' and '\' are escaped the way Apache does,
+// like "\x0a", so a hostile request can not forge a log line.
+func NewTemplateFormatter(text string) (Formatter, error) {
+	tpl, err := template.New("gzap").Funcs(template.FuncMap{
+		"clftime": func(t time.Time) string { return t.Format(clfTimeFormat) },
+		"dash":    func(s string) string { return string(appendDash(nil, s)) },
+		"quote":   func(s string) string { return string(appendQuoted(nil, s)) },
+		"request": func(e *Entry) string { return string(appendRequestLine(nil, e)) },
+		"status":  sentStatus,
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	pool := &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	return FormatterFunc(func(e *Entry) string {
+		buf := pool.Get().(*bytes.Buffer)
+		defer pool.Put(buf)
+		buf.Reset()
+		if err := tpl.Execute(buf, e); err != nil {
+			return "gzap: template format failed, " + err.Error()
+		}
+		return buf.String()
+	}), nil
+}
+
+func appendCommon(b []byte, e *Entry) []byte {
+	b = appendDash(b, e.IP)
+	b = append(b, " - "...)
+	b = appendDash(b, e.User)
+	b = append(b, " ["...)
+	b = e.Time.AppendFormat(b, clfTimeFormat)
+	b = append(b, "] \""...)
+	b = appendRequestLine(b, e)
+	b = append(b, "\" "...)
+	b = strconv.AppendInt(b, int64(sentStatus(e.Status)), 10)
+	b = append(b, ' ')
+	if e.BytesWritten > 0 {
+		b = strconv.AppendInt(b, int64(e.BytesWritten), 10)
+	} else {
+		b = append(b, '-')
+	}
+	return b
+}
+
+// appendRequestLine append the escaped request line, the path is url escaped.
+func appendRequestLine(b []byte, e *Entry) []byte {
+	b = appendEscaped(b, e.Method, true)
+	b = append(b, ' ')
+	b = appendEscaped(b, (&url.URL{Path: e.Path}).EscapedPath(), true)
+	if e.Query != "" {
+		b = append(b, '?')
+		b = appendEscaped(b, e.Query, true)
+	}
+	b = append(b, ' ')
+	b = appendEscaped(b, e.Proto, true)
+	return b
+}
+
+// appendQuoted append the double-quoted and escaped s, an empty s is "-".
+func appendQuoted(b []byte, s string) []byte {
+	if s == "" {
+		return append(b, `"-"`...)
+	}
+	b = append(b, '"')
+	b = appendEscaped(b, s, false)
+	return append(b, '"')
+}
+
+// appendDash append the escaped s, an empty s is "-".
+func appendDash(b []byte, s string) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	return appendEscaped(b, s, true)
+}
+
+// appendEscaped append s with the control characters, non-ASCII bytes and
+// the space if space is true escaped as "\xhh", '"' and '\' are backslash escaped,
+// like Apache ap_escape_logitem.
+func appendEscaped(b []byte, s string, space bool) []byte {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c < 0x20 || c >= 0x7f || (space && c == ' '):
+			b = append(b, '\\', 'x', hex[c>>4], hex[c&0x0f])
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// sentStatus returns the status code net/http sends, 0 means nothing written which is 200.
+func sentStatus(code int) int {
+	if code == 0 {
+		return http.StatusOK
+	}
+	return code
+}
+
+// lockedWriter serializes the writes to the underlying writer.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) WriteLine(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.w, line+"\n")
+}
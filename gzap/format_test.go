@@ -0,0 +1,202 @@
+package gzap
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var testEntryTime = time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60))
+
+func testEntry() *Entry {
+	return &Entry{
+		Time:         testEntryTime,
+		Status:       http.StatusOK,
+		Method:       http.MethodGet,
+		Path:         "/apache_pb.gif",
+		IP:           "127.0.0.1",
+		User:         "frank",
+		UserAgent:    "Mozilla/4.08",
+		Referer:      "http://www.example.com/start.html",
+		BytesWritten: 2326,
+		Proto:        "HTTP/1.0",
+	}
+}
+
+func TestCommonLogFormat(t *testing.T) {
+	tests := map[string]struct {
+		modify func(e *Entry)
+		want   string
+	}{
+		"common": {
+			func(e *Entry) {},
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+		},
+		"empty": {
+			func(e *Entry) { e.IP, e.User, e.BytesWritten = "", "", 0 },
+			`- - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 -`,
+		},
+		"query": {
+			func(e *Entry) { e.Query = "a=1&b=%20" },
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif?a=1&b=%20 HTTP/1.0" 200 2326`,
+		},
+		"nothing written": {
+			func(e *Entry) { e.Status, e.BytesWritten = 0, 0 },
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 -`,
+		},
+		"hostile path": {
+			func(e *Entry) { e.Path = "/a\n1.2.3.4 - - [fake] \"GET / HTTP/1.1\" 200 1" },
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a%0A1.2.3.4%20-%20-%20%5Bfake%5D%20%22GET%20/%20HTTP/1.1%22%20200%201 HTTP/1.0" 200 2326`,
+		},
+		"hostile query": {
+			func(e *Entry) { e.Query = "a=\"\n" },
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif?a=\"\x0a HTTP/1.0" 200 2326`,
+		},
+		"hostile user": {
+			func(e *Entry) { e.User = "fr\"ank\n1.2.3.4 - -" },
+			`127.0.0.1 - fr\"ank\x0a1.2.3.4\x20-\x20- [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+		},
+		"hostile method": {
+			func(e *Entry) { e.Method = "GET /x HTTP/1.1\"\r\n" },
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET\x20/x\x20HTTP/1.1\"\x0d\x0a /apache_pb.gif HTTP/1.0" 200 2326`,
+		},
+	}
+	for name, tt := range tests {
+		e := testEntry()
+		tt.modify(e)
+		if got := CommonLogFormat.Format(e); got != tt.want {
+			t.Errorf("%s: Format() =\n%s\nwant\n%s", name, got, tt.want)
+		}
+	}
+}
+
+func TestCombinedLogFormat(t *testing.T) {
+	tests := map[string]struct {
+		modify func(e *Entry)
+		want   string
+	}{
+		"combined": {
+			func(e *Entry) {},
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+		},
+		"empty": {
+			func(e *Entry) { e.Referer, e.UserAgent = "", "" },
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "-" "-"`,
+		},
+		"hostile user agent": {
+			func(e *Entry) { e.UserAgent = "x\" \"y\\\n\x1b[31m\xe4" },
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "x\" \"y\\\x0a\x1b[31m\xe4"`,
+		},
+	}
+	for name, tt := range tests {
+		e := testEntry()
+		tt.modify(e)
+		if got := CombinedLogFormat.Format(e); got != tt.want {
+			t.Errorf("%s: Format() =\n%s\nwant\n%s", name, got, tt.want)
+		}
+	}
+}
+
+func TestNewTemplateFormatter(t *testing.T) {
+	tests := map[string]struct {
+		text    string
+		modify  func(e *Entry)
+		want    string
+		wantErr bool
+	}{
+		"functions": {
+			text:   `{{dash .IP}} {{dash .User}} [{{clftime .Time}}] "{{request .}}" {{status .Status}} {{quote .UserAgent}}`,
+			modify: func(e *Entry) {},
+			want:   `127.0.0.1 frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 "Mozilla/4.08"`,
+		},
+		"empty and nothing written": {
+			text:   `{{dash .User}} {{status .Status}} {{quote .Referer}}`,
+			modify: func(e *Entry) { e.User, e.Status, e.Referer = "", 0, "" },
+			want:   `- 200 "-"`,
+		},
+		"hostile": {
+			text:   `{{dash .User}} "{{request .}}"`,
+			modify: func(e *Entry) { e.User, e.Path = "a b\n", "/a\nb" },
+			want:   `a\x20b\x0a "GET /a%0Ab HTTP/1.0"`,
+		},
+		"entry fields": {
+			text:   `{{.Method}} {{.Status}} {{.BytesWritten}}`,
+			modify: func(e *Entry) {},
+			want:   `GET 200 2326`,
+		},
+		"parse error": {
+			text:    `{{.Method`,
+			wantErr: true,
+		},
+		"execute error": {
+			text:   `{{.Unknown}}`,
+			modify: func(e *Entry) {},
+			want:   `gzap: template format failed, template: gzap:1:2: executing "gzap" at <.Unknown>: can't evaluate field Unknown in type *gzap.Entry`,
+		},
+	}
+	for name, tt := range tests {
+		f, err := NewTemplateFormatter(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: NewTemplateFormatter() error = %v, wantErr %v", name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		e := testEntry()
+		tt.modify(e)
+		if got := f.Format(e); got != tt.want {
+			t.Errorf("%s: Format() =\n%s\nwant\n%s", name, got, tt.want)
+		}
+	}
+}
+
+func TestLoggerWithWriter(t *testing.T) {
+	tests := map[string]struct {
+		target string
+		user   string
+		want   string
+	}{
+		"request": {
+			target: "/users?id=1",
+			want:   `"POST /users?id=1 HTTP/1.1" 200 -`,
+		},
+		"hostile path": {
+			target: "/a%0A1.2.3.4%20-%20-%20%5Bfake%5D",
+			want:   `"POST /a%0A1.2.3.4%20-%20-%20%5Bfake%5D HTTP/1.1" 200 -`,
+		},
+		"hostile user": {
+			target: "/",
+			user:   "frank\"\n1.2.3.4",
+			want:   `frank\"\x0a1.2.3.4 [`,
+		},
+	}
+	for name, tt := range tests {
+		core, logs := observer.New(zapcore.DebugLevel)
+		var buf bytes.Buffer
+		h := Logger(zap.New(core), WithFormatter(CommonLogFormat), WithWriter(&buf))(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, "password")
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		line := buf.String()
+		if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+			t.Errorf("%s: want a single line, got %q", name, line)
+		}
+		if !strings.Contains(line, tt.want) {
+			t.Errorf("%s: line %q does not contain %q", name, line, tt.want)
+		}
+		if logs.Len() != 0 {
+			t.Errorf("%s: the line should be written to the writer instead of zap", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+//go:build go1.21
+// +build go1.21
+
+// Package gslog provides the gzap.Sink implementation using the standard log/slog,
+// so the services using log/slog share the same access log and recovery semantics
+// of gzap.
+package gslog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/thinkgos/http-middlewares/gzap"
+)
+
+// New returns a gzap.Sink which logs using the log/slog logger.
+func New(logger *slog.Logger) gzap.Sink {
+	return sink{logger}
+}
+
+type sink struct {
+	logger *slog.Logger
+}
+
+func (s sink) Log(lvl zapcore.Level, msg string, fields ...zap.Field) {
+	level := Level(lvl)
+	ctx := context.Background()
+	if !s.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, field := range fields {
+		attrs = appendAttr(attrs, field)
+	}
+	s.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// Level maps the zap level to the slog level,
+// the levels above error are mapped to slog.LevelError.
+func Level(lvl zapcore.Level) slog.Level {
+	switch {
+	case lvl <= zapcore.DebugLevel:
+		return slog.LevelDebug
+	case lvl == zapcore.InfoLevel:
+		return slog.LevelInfo
+	case lvl == zapcore.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// appendAttr converts the zap field to the slog attrs.
+func appendAttr(attrs []slog.Attr, f zap.Field) []slog.Attr {
+	switch f.Type {
+	case zapcore.SkipType:
+		return attrs
+	case zapcore.StringType:
+		return append(attrs, slog.String(f.Key, f.String))
+	case zapcore.BoolType:
+		return append(attrs, slog.Bool(f.Key, f.Integer == 1))
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		return append(attrs, slog.Int64(f.Key, f.Integer))
+	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type:
+		return append(attrs, slog.Uint64(f.Key, uint64(f.Integer)))
+	case zapcore.DurationType:
+		return append(attrs, slog.Duration(f.Key, time.Duration(f.Integer)))
+	case zapcore.ByteStringType:
+		return append(attrs, slog.String(f.Key, string(f.Interface.([]byte))))
+	case zapcore.ErrorType:
+		return append(attrs, slog.Any(f.Key, f.Interface))
+	}
+	// fallback to the zap encoder, it may produce multiple keys.
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	for k, v := range enc.Fields {
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	return attrs
+}
@@ -0,0 +1,70 @@
+//go:build go1.21
+// +build go1.21
+
+package gslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thinkgos/http-middlewares/gzap"
+)
+
+func TestSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := New(slog.New(slog.NewJSONHandler(buf, nil)))
+
+	h := gzap.LoggerWithSink(sink, gzap.WithExtraFields(gzap.FieldBytesWritten))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("pong")) // nolint: errcheck
+		}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping?a=1", nil))
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json %q: %v", buf.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":         "INFO",
+		"msg":           "/ping",
+		"status":        float64(http.StatusOK),
+		"method":        http.MethodGet,
+		"query":         "a=1",
+		"bytes-written": float64(4),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestRecoverySink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := New(slog.New(slog.NewJSONHandler(buf, nil)))
+
+	h := gzap.RecoveryWithSink(sink, true, gzap.WithStructuredStack(true))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("unexpected")
+		}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json %q: %v", buf.String(), err)
+	}
+	if got["level"] != "ERROR" || got["error"] != "unexpected" {
+		t.Errorf("unexpected entry %v", got)
+	}
+	if stack, ok := got["stack"].([]interface{}); !ok || len(stack) == 0 {
+		t.Errorf("stack = %v, want frames", got["stack"])
+	}
+}
@@ -1,16 +1,15 @@
 package gzap
 
 import (
-	"net"
+	"io"
+	"math/rand"
 	"net/http"
-	"net/http/httputil"
-	"os"
-	"runtime/debug"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/thinkgos/http-middlewares/mids"
 )
@@ -39,121 +38,429 @@ func WithCustomFields(fields ...func(r *http.Request) zap.Field) Option {
 	}
 }
 
+// WithExtraFields optional extra access log fields, bit set of ExtraField.(default none)
+func WithExtraFields(fields ExtraField) Option {
+	return func(c *Config) {
+		c.extraFields = fields
+	}
+}
+
+// WithFormatter optional formatter, which render the access log entry as a single line,
+// like CommonLogFormat, CombinedLogFormat or NewTemplateFormatter.
+// The line is logged as the message by zap, or written to the writer if WithWriter set.
+// The extra fields and custom fields are ignored when the formatter is set.
+func WithFormatter(f Formatter) Option {
+	return func(c *Config) {
+		c.formatter = f
+	}
+}
+
+// WithWriter optional writer, which the formatted line is written to instead of zap,
+// only valid when WithFormatter set.
+func WithWriter(w io.Writer) Option {
+	return func(c *Config) {
+		c.writer = &lockedWriter{w: w}
+	}
+}
+
+// WithPanicResponder optional panic responder, which render the response
+// when recovered from panic.(default DefaultPanicResponder)
+func WithPanicResponder(f PanicResponder) Option {
+	return func(c *Config) {
+		c.panicResponder = f
+	}
+}
+
+// WithBrokenPipe optional broken connection classifier, which reports whether
+// the panic value is a broken connection.(default IsBrokenPipe)
+func WithBrokenPipe(f func(err interface{}) bool) Option {
+	return func(c *Config) {
+		c.brokenPipe = f
+	}
+}
+
+// WithOnPanic optional panic hooks, which are called in order after the panic response is rendered,
+// such as forwarding the panic to the alerting pipeline, see ThrottlePanicHook.
+func WithOnPanic(hooks ...PanicHook) Option {
+	return func(c *Config) {
+		c.panicHooks = append(c.panicHooks, hooks...)
+	}
+}
+
+// WithStructuredStack optional output the stack as an array of frames with function,
+// file and line instead of the raw debug.Stack bytes, only valid when stack is true.(default false)
+func WithStructuredStack(b bool) Option {
+	return func(c *Config) {
+		c.structuredStack = b
+	}
+}
+
+// WithStackMaxDepth optional the max depth of the structured stack, 0 means no limit.(default 32)
+func WithStackMaxDepth(depth int) Option {
+	return func(c *Config) {
+		c.stackMaxDepth = depth
+	}
+}
+
+// WithStackFilter optional the frame filter of the structured stack, nil means no filter.(default DefaultStackFilter)
+func WithStackFilter(filter StackFilter) Option {
+	return func(c *Config) {
+		c.stackFilter = filter
+	}
+}
+
+// WithSlowRequest optional slow request watchdog, which logs a warning with the request fields
+// when the request exceeds the threshold while still in flight, and the final entry is marked
+// with field "slow" when it completes, regardless of WithSampleRate and the Runtime level.
+// dump means whether output all the goroutines stack info with the warning.
+// threshold <= 0 means disable.(default disable)
+func WithSlowRequest(threshold time.Duration, dump bool) Option {
+	return func(c *Config) {
+		c.slowThreshold = threshold
+		c.slowDump = dump
+	}
+}
+
+// WithStartEntry optional emit a "[Request started]" entry before the handler,
+// and the paired completion entry shares the same field "correlation-id",
+// which is the request id if present, otherwise a random id.
+// The completion entry is always emitted, regardless of WithSampleRate and the Runtime level,
+// and also if the handler panics, at error level with the field "panicked" and the status 500
+// if nothing written, then the panic keeps going to the outer Recovery.
+// It is useful for the long-lived streaming and websocket endpoints.(default false)
+func WithStartEntry(b bool) Option {
+	return func(c *Config) {
+		c.startEntry = b
+	}
+}
+
+// WithClientIP optional client ip resolver, like (*mids.TrustedProxies).ClientIP
+// which only trusts the forwarded headers from the trusted proxies.(default mids.ClientIP)
+func WithClientIP(f func(r *http.Request) string) Option {
+	return func(c *Config) {
+		c.clientIP = f
+	}
+}
+
+// WithIPEnricher optional client ip enrichment hook, which adds the fields of the client ip
+// to the access log, like the ASN or country lookup from a local MaxMind-format database file.
+func WithIPEnricher(f func(ip string) []zap.Field) Option {
+	return func(c *Config) {
+		c.ipEnricher = f
+	}
+}
+
+// WithSkipPaths optional the paths which are not logged, like the health check.
+func WithSkipPaths(paths ...string) Option {
+	return func(c *Config) {
+		if c.skipPaths == nil {
+			c.skipPaths = make(map[string]struct{}, len(paths))
+		}
+		for _, path := range paths {
+			c.skipPaths[path] = struct{}{}
+		}
+	}
+}
+
+// WithRequestHeaders optional the request headers which are logged with key "headers".
+func WithRequestHeaders(headers ...string) Option {
+	return func(c *Config) {
+		for _, h := range headers {
+			c.requestHeaders = append(c.requestHeaders, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// WithSampleRate optional the sample rate in [0, 1] of the access log,
+// only the requests with status < 400 and without errors are sampled,
+// the requests are not sampled if WithStartEntry set or the request is slow.(default 1)
+func WithSampleRate(rate float64) Option {
+	return func(c *Config) {
+		c.sampleRate = rate
+	}
+}
+
+// WithStatusLevel optional the status code to log level mapping of the access log,
+// the requests with errors are logged at least error level.(default info level)
+func WithStatusLevel(f func(status int) zapcore.Level) Option {
+	return func(c *Config) {
+		c.statusLevel = f
+	}
+}
+
+// WithRuntime optional runtime adjustable settings, see Runtime.Handler
+// for the mountable admin handler. The debug captures are ignored if WithFormatter set,
+// only the runtime level applies.
+func WithRuntime(rt *Runtime) Option {
+	return func(c *Config) {
+		c.runtime = rt
+	}
+}
+
+// WithRedactedHeaders optional the request headers which are redacted in the
+// debug capture of Runtime, it replaces the default list,
+// extend it like WithRedactedHeaders(append(DefaultRedactedHeaders, "X-Secret")...).
+// (default DefaultRedactedHeaders)
+func WithRedactedHeaders(headers ...string) Option {
+	return func(c *Config) {
+		c.redactedHeaders = newHeaderSet(headers)
+	}
+}
+
+// WithOmitTime optional omit the formatted "time" field of the access log,
+// which duplicates the timestamp of zap.(default false)
+func WithOmitTime(b bool) Option {
+	return func(c *Config) {
+		c.omitTime = b
+	}
+}
+
 // Config logger/recover config
 type Config struct {
 	timeFormat   string
 	utc          bool
+	omitTime     bool
 	customFields []func(r *http.Request) zap.Field
+	extraFields  ExtraField
+	formatter    Formatter
+	writer       *lockedWriter
+	startEntry   bool
+	clientIP     func(r *http.Request) string
+	ipEnricher   func(ip string) []zap.Field
+	// filter and level
+	skipPaths      map[string]struct{}
+	requestHeaders []string
+	sampleRate     float64
+	statusLevel    func(status int) zapcore.Level
+	runtime        *Runtime
+	// redactedHeaders the canonical header names redacted in the debug capture
+	redactedHeaders map[string]struct{}
+	// slow request watchdog
+	slowThreshold time.Duration
+	slowDump      bool
+	// recovery
+	panicResponder PanicResponder
+	brokenPipe     func(err interface{}) bool
+	panicHooks     []PanicHook
+	// structured stack
+	structuredStack bool
+	stackMaxDepth   int
+	stackFilter     StackFilter
 }
 
-// Logger returns a gin.HandlerFunc (middleware) that logs requests using uber-go/zap.
-//
-// Requests with errors are logged using zap.Error().
-// Requests without errors are logged using zap.Info().
-func Logger(logger *zap.Logger, opts ...Option) func(next http.Handler) http.Handler {
+func newConfig(opts ...Option) Config {
 	cfg := Config{
-		time.RFC3339Nano,
-		false,
-		nil,
+		timeFormat:     time.RFC3339Nano,
+		clientIP:       mids.ClientIP,
+		sampleRate:     1,
+		panicResponder: DefaultPanicResponder,
+		brokenPipe:     IsBrokenPipe,
+		stackMaxDepth:  32,
+		stackFilter:    DefaultStackFilter,
 	}
+	cfg.redactedHeaders = newHeaderSet(DefaultRedactedHeaders)
 	for _, opt := range opts {
 		opt(&cfg)
 	}
+	return cfg
+}
+
+// level returns the log level of the access log entry.
+func (c *Config) level(status int, hasErrors bool) zapcore.Level {
+	lvl := zapcore.InfoLevel
+	if c.statusLevel != nil {
+		lvl = c.statusLevel(status)
+	}
+	if hasErrors && lvl < zapcore.ErrorLevel {
+		lvl = zapcore.ErrorLevel
+	}
+	return lvl
+}
+
+// sampled reports whether the access log entry should be logged.
+func (c *Config) sampled(status int, hasErrors bool) bool {
+	if c.sampleRate >= 1 || status >= http.StatusBadRequest || hasErrors {
+		return true
+	}
+	return rand.Float64() < c.sampleRate // nolint: gosec
+}
+
+// fieldsPool the pool of the access log fields, reduce the allocation per request.
+var fieldsPool = sync.Pool{
+	New: func() interface{} {
+		fields := make([]zap.Field, 0, 32)
+		return &fields
+	},
+}
+
+func putFields(fp *[]zap.Field) {
+	fields := *fp
+	// release the references for gc.
+	for i := range fields {
+		fields[i] = zap.Field{}
+	}
+	*fp = fields[:0]
+	fieldsPool.Put(fp)
+}
+
+// Logger returns a gin.HandlerFunc (middleware) that logs requests using uber-go/zap.
+// The downstream handlers can enrich the access log entry with AddFields,
+// and report the errors with SetError.
+//
+// Requests with errors are logged using zap.Error().
+// Requests without errors are logged using zap.Info().
+func Logger(logger *zap.Logger, opts ...Option) func(next http.Handler) http.Handler {
+	return LoggerWithSink(ZapSink(logger), opts...)
+}
+
+// LoggerWithSink same as Logger, but logs requests using the sink.
+func LoggerWithSink(sink Sink, opts ...Option) func(next http.Handler) http.Handler {
+	cfg := newConfig(opts...)
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			// some evil middlewares modify this values
 			path := r.URL.Path
 			query := r.URL.RawQuery
+			if _, ok := cfg.skipPaths[path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var body *bodyReader
+			if cfg.extraFields.Has(FieldBytesRead) && r.Body != nil && r.Body != http.NoBody {
+				body = &bodyReader{ReadCloser: r.Body}
+				r.Body = body
+			}
+			var correlationID string
+			if cfg.startEntry {
+				correlationID = newCorrelationID(r)
+				sink.Log(zapcore.InfoLevel, "[Request started]",
+					append(requestFields(&cfg, r, path, query), zap.String("correlation-id", correlationID))...)
+			}
+			var watchdog *slowWatchdog
+			if cfg.slowThreshold > 0 {
+				watchdog = watchSlowRequest(sink, &cfg, r, start, path, query)
+				defer watchdog.Stop() // the handler may panic
+			}
+			ctx, acc := newAccumulatorContext(r.Context())
+			r = r.WithContext(ctx)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-			next.ServeHTTP(ww, r)
-
-			end := time.Now()
-			latency := end.Sub(start)
-			if cfg.utc {
-				end = end.UTC()
+			var capture *capturing
+			if cfg.runtime != nil && cfg.formatter == nil {
+				if c := cfg.runtime.match(path); c != nil {
+					capture = startCapture(c, r, ww)
+				}
 			}
-
-			fields := []zap.Field{
-				zap.Int("status", ww.Status()),
-				zap.String("method", r.Method),
-				zap.String("path", path),
-				zap.String("query", query),
-				zap.String("ip", mids.ClientIP(r)),
-				zap.String("user-agent", r.UserAgent()),
-				zap.String("time", end.Format(cfg.timeFormat)),
-				zap.Duration("latency", latency),
+			fs := finishState{
+				cfg:           &cfg,
+				sink:          sink,
+				r:             r,
+				ww:            ww,
+				body:          body,
+				start:         start,
+				path:          path,
+				query:         query,
+				watchdog:      watchdog,
+				acc:           acc,
+				capture:       capture,
+				correlationID: correlationID,
 			}
-			for _, field := range cfg.customFields {
-				fields = append(fields, field(r))
+			if cfg.startEntry {
+				completed := false
+				defer func() {
+					// the handler panicked, emit the finish entry paired with the start entry,
+					// the panic keeps going to the outer Recovery.
+					if !completed {
+						fs.log(true)
+					}
+				}()
+				next.ServeHTTP(ww, r)
+				completed = true
+			} else {
+				next.ServeHTTP(ww, r)
 			}
-			logger.Info(path, fields...)
+			fs.log(false)
 		}
 		return http.HandlerFunc(fn)
 	}
 }
 
-// Recovery returns a gin.HandlerFunc (middleware)
-// that recovers from any panics and logs requests using uber-go/zap.
-// All errors are logged using zap.Error().
-// stack means whether output the stack info.
-// The stack info is easy to find where the error occurs but the stack info is too large.
-func Recovery(logger *zap.Logger, stack bool, opts ...Option) func(next http.Handler) http.Handler {
-	cfg := Config{
-		time.RFC3339Nano,
-		false,
-		nil,
+// finishState the state of an access log request, which logs the finish entry.
+type finishState struct {
+	cfg           *Config
+	sink          Sink
+	r             *http.Request
+	ww            middleware.WrapResponseWriter
+	body          *bodyReader
+	start         time.Time
+	path          string
+	query         string
+	watchdog      *slowWatchdog
+	acc           *accumulator
+	capture       *capturing
+	correlationID string
+}
+
+// log logs the finish entry, panicked means the handler panicked,
+// the status is reported as 500 if nothing was written.
+func (fs *finishState) log(panicked bool) {
+	cfg, r, path := fs.cfg, fs.r, fs.path
+	slow := fs.watchdog != nil && fs.watchdog.Stop()
+	entry := newEntry(cfg, r, fs.ww, fs.body, fs.start, path, fs.query)
+	defer putEntry(entry)
+	if panicked && entry.Status == 0 {
+		entry.Status = http.StatusInternalServerError
 	}
-	for _, opt := range opts {
-		opt(&cfg)
+	hasErrors := fs.acc.hasErrors() || panicked
+	level := cfg.level(entry.Status, hasErrors)
+	// the finish entry paired with the start entry or the slow warning is always emitted.
+	if !cfg.startEntry && !slow && fs.capture == nil {
+		if !cfg.sampled(entry.Status, hasErrors) {
+			return
+		}
+		if cfg.runtime != nil && !cfg.runtime.Level().Enabled(level) {
+			return
+		}
 	}
-	return func(next http.Handler) http.Handler {
-		fn := func(w http.ResponseWriter, r *http.Request) {
-			defer func() {
-				if err := recover(); err != nil {
-					// Check for a broken connection, as it is not really a
-					// condition that warrants a panic stack trace.
-					var brokenPipe bool
-					if ne, ok := err.(*net.OpError); ok {
-						if se, ok := ne.Err.(*os.SyscallError); ok {
-							if strings.Contains(strings.ToLower(se.Error()), "broken pipe") ||
-								strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
-								brokenPipe = true
-							}
-						}
-					}
-
-					httpRequest, _ := httputil.DumpRequest(r, false)
-					if brokenPipe {
-						logger.Error(r.URL.Path,
-							zap.Any("error", err),
-							zap.ByteString("request", httpRequest),
-						)
-						w.WriteHeader(http.StatusInternalServerError)
-						return
-					}
-
-					now := time.Now()
-					if cfg.utc {
-						now = now.UTC()
-					}
-					fields := []zap.Field{
-						zap.String("time", now.Format(cfg.timeFormat)),
-						zap.Any("error", err),
-						zap.ByteString("request", httpRequest),
-					}
-					for _, field := range cfg.customFields {
-						fields = append(fields, field(r))
-					}
-					if stack {
-						fields = append(fields, zap.ByteString("stack", debug.Stack()))
-					}
-					logger.Error("[Recovery from panic]", fields...)
-					w.WriteHeader(http.StatusInternalServerError)
-				}
-			}()
-			next.ServeHTTP(w, r)
+	if cfg.formatter != nil {
+		line := cfg.formatter.Format(entry)
+		if cfg.writer != nil {
+			cfg.writer.WriteLine(line)
+		} else {
+			fs.sink.Log(level, line)
 		}
-		return http.HandlerFunc(fn)
+		return
+	}
+
+	fp := fieldsPool.Get().(*[]zap.Field)
+	defer putFields(fp)
+	timeFormat := cfg.timeFormat
+	if cfg.omitTime {
+		timeFormat = ""
+	}
+	fields := entry.appendFields((*fp)[:0], timeFormat, cfg.extraFields)
+	if len(cfg.requestHeaders) > 0 {
+		fields = append(fields, zap.Object("headers", headerFields{r.Header, cfg.requestHeaders}))
+	}
+	if cfg.ipEnricher != nil {
+		fields = append(fields, cfg.ipEnricher(entry.IP)...)
+	}
+	for _, field := range cfg.customFields {
+		fields = append(fields, field(r))
+	}
+	fields = fs.acc.appendFields(fields)
+	if slow {
+		fields = append(fields, zap.Bool("slow", true))
+	}
+	if panicked {
+		fields = append(fields, zap.Bool("panicked", true))
+	}
+	if cfg.startEntry {
+		fields = append(fields, zap.String("correlation-id", fs.correlationID))
+	}
+	if fs.capture != nil {
+		fields = fs.capture.appendFields(fields, r, cfg.redactedHeaders)
 	}
+	fs.sink.Log(level, path, fields...)
+	*fp = fields
 }
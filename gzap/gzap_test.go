@@ -0,0 +1,299 @@
+package gzap
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/thinkgos/http-middlewares/mids"
+)
+
+func TestLoggerSlowRequest(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core), WithSlowRequest(10*time.Millisecond, true))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("log entries = %d, want 2", len(entries))
+	}
+	warn := entries[0]
+	if warn.Level != zapcore.WarnLevel || warn.ContextMap()["path"] != "/slow" {
+		t.Errorf("unexpected warning entry %v", warn)
+	}
+	if _, ok := warn.ContextMap()["goroutines"]; !ok {
+		t.Errorf("warning entry should contain goroutines dump")
+	}
+	if final := entries[1]; final.Level != zapcore.InfoLevel || final.ContextMap()["slow"] != true {
+		t.Errorf("unexpected final entry %v", final)
+	}
+
+	// fast request
+	logs.TakeAll()
+	h = Logger(zap.New(core), WithSlowRequest(time.Second, false))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if entries := logs.All(); len(entries) != 1 || entries[0].ContextMap()["slow"] != nil {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestLoggerSlowRequestAlwaysFinished(t *testing.T) {
+	rt := NewRuntime()
+	rt.Level().SetLevel(zapcore.ErrorLevel)
+	tests := map[string]struct {
+		opts []Option
+	}{
+		"sampled out":   {[]Option{WithSampleRate(0)}},
+		"runtime level": {[]Option{WithRuntime(rt)}},
+	}
+	for name, tt := range tests {
+		core, logs := observer.New(zapcore.DebugLevel)
+		h := Logger(zap.New(core), append(tt.opts, WithSlowRequest(5*time.Millisecond, false))...)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(50 * time.Millisecond)
+			}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+		entries := logs.All()
+		if len(entries) != 2 {
+			t.Fatalf("%s: log entries = %d, want 2", name, len(entries))
+		}
+		if entries[0].Message != "[Slow request in flight]" || entries[1].ContextMap()["slow"] != true {
+			t.Errorf("%s: unexpected entries %v", name, entries)
+		}
+	}
+}
+
+func TestLoggerStartEntry(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core), WithStartEntry(true))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// like websocket, the hijacked connection writes the status itself.
+		}))
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("log entries = %d, want 2", len(entries))
+	}
+	started, finished := entries[0].ContextMap(), entries[1].ContextMap()
+	if entries[0].Message != "[Request started]" {
+		t.Errorf("start entry message = %q", entries[0].Message)
+	}
+	if id := started["correlation-id"]; id == "" || id != finished["correlation-id"] {
+		t.Errorf("correlation-id mismatch, %v != %v", id, finished["correlation-id"])
+	}
+	if finished["status"] != int64(http.StatusSwitchingProtocols) || finished["upgraded"] != true {
+		t.Errorf("unexpected finished entry %v", finished)
+	}
+}
+
+func TestLoggerStartEntryPanic(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core)
+	h := Recovery(logger, false)(Logger(logger, WithStartEntry(true))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("unexpected")
+		})))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	entries := logs.All()
+	if len(entries) != 3 {
+		t.Fatalf("log entries = %d, want 3", len(entries))
+	}
+	if entries[0].Message != "[Request started]" || entries[2].Message != "[Recovery from panic]" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+	started, finished := entries[0].ContextMap(), entries[1].ContextMap()
+	if id := started["correlation-id"]; id == "" || id != finished["correlation-id"] {
+		t.Errorf("correlation-id mismatch, %v != %v", id, finished["correlation-id"])
+	}
+	if finished["panicked"] != true || finished["status"] != int64(http.StatusInternalServerError) ||
+		entries[1].Level != zapcore.ErrorLevel {
+		t.Errorf("unexpected finished entry %v", finished)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestLoggerStartEntryPaired(t *testing.T) {
+	rt := NewRuntime()
+	rt.Level().SetLevel(zapcore.ErrorLevel)
+	tests := map[string]struct {
+		opts []Option
+		want int
+	}{
+		"sampled out":           {[]Option{WithSampleRate(0)}, 0},
+		"runtime level":         {[]Option{WithRuntime(rt)}, 0},
+		"start sampled out":     {[]Option{WithStartEntry(true), WithSampleRate(0)}, 2},
+		"start runtime level":   {[]Option{WithStartEntry(true), WithRuntime(rt)}, 2},
+		"start without dropper": {[]Option{WithStartEntry(true)}, 2},
+	}
+	for name, tt := range tests {
+		core, logs := observer.New(zapcore.DebugLevel)
+		h := Logger(zap.New(core), tt.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if logs.Len() != tt.want {
+			t.Errorf("%s: log entries = %d, want %d", name, logs.Len(), tt.want)
+		}
+	}
+}
+
+func TestAddFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddFields(r.Context(), zap.String("user-id", "u1"))
+			AddFields(r.Context(), zap.Bool("cache-hit", true), zap.Int("order-id", 42))
+		}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("log entries = %d, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["user-id"] != "u1" || fields["cache-hit"] != true || fields["order-id"] != int64(42) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	// without Logger, discarded
+	AddFields(httptest.NewRequest(http.MethodGet, "/", nil).Context(), zap.String("user-id", "u1"))
+}
+
+func TestSetError(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			SetError(r, nil)
+			SetError(r, errors.New("db timeout"))
+			SetError(r, errors.New("cache miss"))
+			if errs := Errors(r); len(errs) != 2 {
+				t.Errorf("Errors() = %v, want 2 errors", errs)
+			}
+		}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("log entries = %d, want 1", len(entries))
+	}
+	if entries[0].Level != zapcore.ErrorLevel {
+		t.Errorf("level = %v, want error", entries[0].Level)
+	}
+	if errs, ok := entries[0].ContextMap()["errors"].([]interface{}); !ok || len(errs) != 2 {
+		t.Errorf("errors = %v, want 2 errors", entries[0].ContextMap()["errors"])
+	}
+}
+
+func TestLoggerClientIP(t *testing.T) {
+	proxies, err := mids.NewTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core),
+		WithClientIP(proxies.ClientIP),
+		WithIPEnricher(func(ip string) []zap.Field {
+			return []zap.Field{zap.String("country", "ZZ:"+ip)}
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "1.2.3.4:1234"
+	r.Header.Set("X-Forwarded-For", "8.8.8.8")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	fields := logs.All()[0].ContextMap()
+	if fields["ip"] != "1.2.3.4" || fields["country"] != "ZZ:1.2.3.4" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func TestLoggerExtraFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	router := chi.NewRouter()
+	router.Use(Logger(zap.New(core), WithExtraFields(FieldAll)))
+	router.Post("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 4)
+		_, _ = io.ReadFull(r.Body, buf)
+		w.Write([]byte("response")) // nolint: errcheck
+	})
+	r := httptest.NewRequest(http.MethodPost, "https://example.com/users/1", strings.NewReader("hello world"))
+	r.TLS = &tls.ConnectionState{
+		Version:     tls.VersionTLS13,
+		CipherSuite: tls.TLS_AES_128_GCM_SHA256,
+	}
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("log entries = %d, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	want := map[string]interface{}{
+		"status":         int64(http.StatusOK),
+		"bytes-written":  int64(len("response")),
+		"content-length": int64(len("hello world")),
+		"bytes-read":     int64(4),
+		"proto":          "HTTP/1.1",
+		"host":           "example.com",
+		"scheme":         "https",
+		"tls-version":    "TLS 1.3",
+		"tls-cipher":     "TLS_AES_128_GCM_SHA256",
+		"route":          "/users/{id}",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %v, want %v", key, fields[key], value)
+		}
+	}
+
+	// without the extra fields
+	logs.TakeAll()
+	h := Logger(zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	fields = logs.All()[0].ContextMap()
+	for key := range want {
+		if _, ok := fields[key]; ok && key != "status" {
+			t.Errorf("unexpected field %s", key)
+		}
+	}
+}
+
+func TestTLSVersionName(t *testing.T) {
+	tests := map[string]struct {
+		version uint16
+		want    string
+	}{
+		"TLS 1.0": {tls.VersionTLS10, "TLS 1.0"},
+		"TLS 1.1": {tls.VersionTLS11, "TLS 1.1"},
+		"TLS 1.2": {tls.VersionTLS12, "TLS 1.2"},
+		"TLS 1.3": {tls.VersionTLS13, "TLS 1.3"},
+		"unknown": {0x0300, "0x0300"},
+	}
+	for name, tt := range tests {
+		if got := tlsVersionName(tt.version); got != tt.want {
+			t.Errorf("%s: tlsVersionName() = %q, want %q", name, got, tt.want)
+		}
+	}
+}
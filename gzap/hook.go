@@ -0,0 +1,96 @@
+package gzap
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// PanicHook is called when recovered from panic except the broken connection,
+// err is the panic value, stack is the stack trace of the goroutine.
+// It runs on the request goroutine after the panic response is rendered,
+// it should not block, like hand over the network call to another goroutine.
+// A panicking hook is recovered and logged.
+type PanicHook func(r *http.Request, err interface{}, stack []byte)
+
+// runPanicHook calls the hook, a panic in the hook is logged instead of escaping Recovery.
+func runPanicHook(sink Sink, hook PanicHook, r *http.Request, err interface{}, stack []byte) {
+	defer func() {
+		if v := recover(); v != nil {
+			sink.Log(zapcore.ErrorLevel, "[Panic hook failed]",
+				zap.Any("error", v),
+				zap.Any("panic", err),
+			)
+		}
+	}()
+	hook(r, err, stack)
+}
+
+// ThrottlePanicHook returns a PanicHook which calls hook at most once per interval
+// for the same panic site, the site is the function and the line where the panic occurred,
+// so a hot panic loop doesn't spam the alerting pipeline.
+// The suppressed panics are still logged by Recovery.
+func ThrottlePanicHook(hook PanicHook, interval time.Duration) PanicHook {
+	var mu sync.Mutex
+	lastSeen := make(map[string]time.Time)
+	lastSweep := time.Now()
+	return func(r *http.Request, err interface{}, stack []byte) {
+		site := panicSite(stack)
+		now := time.Now()
+
+		mu.Lock()
+		// sweep the expired sites, keep the map small.
+		if now.Sub(lastSweep) > interval {
+			for k, t := range lastSeen {
+				if now.Sub(t) >= interval {
+					delete(lastSeen, k)
+				}
+			}
+			lastSweep = now
+		}
+		if t, ok := lastSeen[site]; ok && now.Sub(t) < interval {
+			mu.Unlock()
+			return
+		}
+		lastSeen[site] = now
+		mu.Unlock()
+
+		hook(r, err, stack)
+	}
+}
+
+// panicSite returns the function and the file line where the panic occurred,
+// which parsed from the stack trace, like:
+//
+//	main.handler /path/to/main.go:10
+//
+// the runtime frames are skipped. It returns the whole stack if not found.
+func panicSite(stack []byte) string {
+	lines := bytes.Split(stack, []byte("\n"))
+	for i := range lines {
+		if !bytes.HasPrefix(lines[i], []byte("panic(")) {
+			continue
+		}
+		// function line followed by the file line.
+		for j := i + 2; j+1 < len(lines); j += 2 {
+			fn := lines[j]
+			if bytes.HasPrefix(fn, []byte("runtime.")) {
+				continue
+			}
+			if k := bytes.LastIndexByte(fn, '('); k > 0 {
+				fn = fn[:k]
+			}
+			file := bytes.TrimSpace(lines[j+1])
+			if k := bytes.LastIndex(file, []byte(" +0x")); k > 0 {
+				file = file[:k]
+			}
+			return string(fn) + " " + string(file)
+		}
+		break
+	}
+	return string(stack)
+}
@@ -0,0 +1,71 @@
+package gzap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func panicA(w http.ResponseWriter, r *http.Request) { panic("a") }
+func panicB(w http.ResponseWriter, r *http.Request) { panic("b") }
+
+func TestThrottlePanicHook(t *testing.T) {
+	var called int32
+	var site string
+	hook := ThrottlePanicHook(func(r *http.Request, err interface{}, stack []byte) {
+		atomic.AddInt32(&called, 1)
+		site = panicSite(stack)
+	}, time.Hour)
+
+	recovery := Recovery(zap.NewNop(), false, WithOnPanic(hook))
+	ha := recovery(http.HandlerFunc(panicA))
+	hb := recovery(http.HandlerFunc(panicB))
+	for i := 0; i < 10; i++ {
+		ha.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if got := atomic.LoadInt32(&called); got != 1 {
+		t.Fatalf("hook called %d times, want 1", got)
+	}
+	if !strings.Contains(site, "gzap.panicA") || !strings.Contains(site, "hook_test.go:") {
+		t.Errorf("panic site = %q, want gzap.panicA in hook_test.go", site)
+	}
+	hb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := atomic.LoadInt32(&called); got != 2 {
+		t.Fatalf("hook called %d times, want 2", got)
+	}
+}
+
+func TestPanicHookOrder(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	w := httptest.NewRecorder()
+	var called []string
+	h := Recovery(zap.New(core), false, WithOnPanic(
+		func(r *http.Request, err interface{}, stack []byte) {
+			called = append(called, "failing")
+			if w.Code != http.StatusInternalServerError || !w.Flushed {
+				t.Errorf("the response should be rendered and flushed before the hooks")
+			}
+			panic("hook failed")
+		},
+		func(r *http.Request, err interface{}, stack []byte) {
+			called = append(called, "next")
+		},
+	))(http.HandlerFunc(panicA))
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if strings.Join(called, ",") != "failing,next" {
+		t.Errorf("called hooks = %v, want failing,next", called)
+	}
+	entries := logs.All()
+	if len(entries) != 2 || entries[1].Message != "[Panic hook failed]" ||
+		entries[1].ContextMap()["error"] != "hook failed" {
+		t.Errorf("unexpected log entries %v", entries)
+	}
+}
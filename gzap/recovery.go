@@ -0,0 +1,191 @@
+package gzap
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// PanicResponder render the response when recovered from panic.
+// It is only called when the response has not been written, flushed or hijacked.
+type PanicResponder func(w http.ResponseWriter, r *http.Request, err interface{})
+
+// DefaultPanicResponder write a bare 500 status code without body.
+func DefaultPanicResponder(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+// JSONPanicResponder write a 500 status code with a json body, like:
+//
+//	{"code":500,"message":"Internal Server Error"}
+func JSONPanicResponder(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+	renderPanicJSON(w, "application/json; charset=utf-8", map[string]interface{}{
+		"code":    http.StatusInternalServerError,
+		"message": http.StatusText(http.StatusInternalServerError),
+	})
+}
+
+// ProblemPanicResponder write a 500 status code with a RFC 7807 problem details body, like:
+//
+//	{"type":"about:blank","title":"Internal Server Error","status":500,"instance":"/path"}
+func ProblemPanicResponder(w http.ResponseWriter, r *http.Request, _ interface{}) {
+	renderPanicJSON(w, "application/problem+json", map[string]interface{}{
+		"type":     "about:blank",
+		"title":    http.StatusText(http.StatusInternalServerError),
+		"status":   http.StatusInternalServerError,
+		"instance": r.URL.Path,
+	})
+}
+
+var panicHTML = template.Must(template.New("panic").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Code}} {{.Text}}</title></head>
+<body><h1>{{.Code}} {{.Text}}</h1></body>
+</html>
+`))
+
+// HTMLPanicResponder write a 500 status code with a simple html page.
+func HTMLPanicResponder(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = panicHTML.Execute(w, struct {
+		Code int
+		Text string
+	}{
+		http.StatusInternalServerError,
+		http.StatusText(http.StatusInternalServerError),
+	})
+}
+
+func renderPanicJSON(w http.ResponseWriter, contentType string, data interface{}) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = w.Write(content)
+}
+
+// IsBrokenPipe reports whether the panic value v is a broken connection error,
+// such as broken pipe or connection reset by peer. The error may be wrapped.
+func IsBrokenPipe(v interface{}) bool {
+	err, ok := v.(error)
+	if !ok {
+		return false
+	}
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	// fallback to the message, the platform errno may be different.
+	var se *os.SyscallError
+	if errors.As(err, &se) {
+		return isBrokenPipeMessage(se.Error())
+	}
+	var ne *net.OpError
+	if errors.As(err, &ne) {
+		return isBrokenPipeMessage(ne.Error())
+	}
+	return false
+}
+
+func isBrokenPipeMessage(s string) bool {
+	s = strings.ToLower(s)
+	return strings.Contains(s, "broken pipe") ||
+		strings.Contains(s, "connection reset by peer")
+}
+
+// Recovery returns a gin.HandlerFunc (middleware)
+// that recovers from any panics and logs requests using uber-go/zap.
+// All errors are logged using zap.Error().
+// stack means whether output the stack info.
+// The stack info is easy to find where the error occurs but the stack info is too large.
+// The response is rendered by the panic responder only if it has not been started
+// (written, flushed or hijacked),
+// http.ErrAbortHandler is re-panicked as net/http expects.
+func Recovery(logger *zap.Logger, stack bool, opts ...Option) func(next http.Handler) http.Handler {
+	return RecoveryWithSink(ZapSink(logger), stack, opts...)
+}
+
+// RecoveryWithSink same as Recovery, but logs using the sink.
+func RecoveryWithSink(sink Sink, stack bool, opts ...Option) func(next http.Handler) http.Handler {
+	cfg := newConfig(opts...)
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			sw, tracker := newSentWriter(w, r.ProtoMajor)
+			defer func() {
+				if err := recover(); err != nil {
+					// http.ErrAbortHandler is a sentinel panic value to abort a handler,
+					// net/http suppresses logging a stack trace for it.
+					if err == http.ErrAbortHandler { // nolint: errorlint
+						panic(err)
+					}
+					httpRequest, _ := httputil.DumpRequest(r, false)
+					// Check for a broken connection, as it is not really a
+					// condition that warrants a panic stack trace.
+					if cfg.brokenPipe(err) {
+						// the connection is dead, we can't write a status to it.
+						sink.Log(zapcore.ErrorLevel, r.URL.Path,
+							zap.Any("error", err),
+							zap.ByteString("request", httpRequest),
+						)
+						return
+					}
+
+					now := time.Now()
+					if cfg.utc {
+						now = now.UTC()
+					}
+					fields := []zap.Field{
+						zap.String("time", now.Format(cfg.timeFormat)),
+						zap.Any("error", err),
+						zap.ByteString("request", httpRequest),
+					}
+					for _, field := range cfg.customFields {
+						fields = append(fields, field(r))
+					}
+					var stackInfo []byte
+					if (stack && !cfg.structuredStack) || len(cfg.panicHooks) > 0 {
+						stackInfo = debug.Stack()
+					}
+					if stack {
+						if cfg.structuredStack {
+							fields = append(fields, zap.Array("stack", panicFrames(cfg.stackFilter, cfg.stackMaxDepth)))
+						} else {
+							fields = append(fields, zap.ByteString("stack", stackInfo))
+						}
+					}
+					sink.Log(zapcore.ErrorLevel, "[Recovery from panic]", fields...)
+					// headers already sent, flushed or the connection hijacked,
+					// a superfluous WriteHeader is useless.
+					if !tracker.sent {
+						cfg.panicResponder(w, r, err)
+						// deliver the response before the hooks run.
+						if f, ok := w.(http.Flusher); ok && len(cfg.panicHooks) > 0 {
+							f.Flush()
+						}
+					}
+					for _, hook := range cfg.panicHooks {
+						runPanicHook(sink, hook, r, err, stackInfo)
+					}
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
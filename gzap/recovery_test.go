@@ -0,0 +1,230 @@
+package gzap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestIsBrokenPipe(t *testing.T) {
+	opError := func(err error) error {
+		return &net.OpError{Op: "write", Net: "tcp", Err: err}
+	}
+	tests := map[string]struct {
+		value interface{}
+		want  bool
+	}{
+		"nil":                      {nil, false},
+		"string panic":             {"broken pipe", false},
+		"not broken pipe error":    {errors.New("something wrong"), false},
+		"EPIPE":                    {syscall.EPIPE, true},
+		"ECONNRESET":               {syscall.ECONNRESET, true},
+		"syscall error EPIPE":      {os.NewSyscallError("write", syscall.EPIPE), true},
+		"op error EPIPE":           {opError(os.NewSyscallError("write", syscall.EPIPE)), true},
+		"op error ECONNRESET":      {opError(os.NewSyscallError("read", syscall.ECONNRESET)), true},
+		"op error other errno":     {opError(os.NewSyscallError("write", syscall.EINVAL)), false},
+		"wrapped op error EPIPE":   {fmt.Errorf("write response: %w", opError(syscall.EPIPE)), true},
+		"wrapped twice ECONNRESET": {fmt.Errorf("a: %w", fmt.Errorf("b: %w", syscall.ECONNRESET)), true},
+		"op error message":         {opError(os.NewSyscallError("wsasend", errors.New("Broken Pipe"))), true},
+	}
+	for name, tt := range tests {
+		if got := IsBrokenPipe(tt.value); got != tt.want {
+			t.Errorf("%s: IsBrokenPipe() = %v, want %v", name, got, tt.want)
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	tests := map[string]struct {
+		panicValue    interface{}
+		opts          []Option
+		responder     PanicResponder
+		before        func(w http.ResponseWriter)
+		wantStatus    int
+		wantMessage   string
+		wantResponded bool
+	}{
+		"panic": {
+			panicValue:    "unexpected",
+			wantStatus:    http.StatusInternalServerError,
+			wantMessage:   "[Recovery from panic]",
+			wantResponded: true,
+		},
+		"broken pipe": {
+			panicValue:  &net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)},
+			wantStatus:  http.StatusOK, // nothing written
+			wantMessage: "/",
+		},
+		"custom classifier": {
+			panicValue:  "client gone",
+			opts:        []Option{WithBrokenPipe(func(err interface{}) bool { return err == "client gone" })},
+			wantStatus:  http.StatusOK, // nothing written
+			wantMessage: "/",
+		},
+		"already written": {
+			panicValue:  "unexpected",
+			before:      func(w http.ResponseWriter) { w.WriteHeader(http.StatusAccepted) },
+			wantStatus:  http.StatusAccepted,
+			wantMessage: "[Recovery from panic]",
+		},
+		"already flushed": {
+			panicValue:  "unexpected",
+			before:      func(w http.ResponseWriter) { w.(http.Flusher).Flush() },
+			wantStatus:  http.StatusOK,
+			wantMessage: "[Recovery from panic]",
+		},
+		"already hijacked": {
+			panicValue: "unexpected",
+			before: func(w http.ResponseWriter) {
+				_, _, _ = w.(http.Hijacker).Hijack()
+			},
+			wantStatus:  http.StatusOK, // nothing written
+			wantMessage: "[Recovery from panic]",
+		},
+		"json responder": {
+			panicValue:    "unexpected",
+			responder:     JSONPanicResponder,
+			wantStatus:    http.StatusInternalServerError,
+			wantMessage:   "[Recovery from panic]",
+			wantResponded: true,
+		},
+	}
+	for name, tt := range tests {
+		responder := tt.responder
+		if responder == nil {
+			responder = DefaultPanicResponder
+		}
+		var responded bool
+		opts := append(tt.opts, WithPanicResponder(func(w http.ResponseWriter, r *http.Request, err interface{}) {
+			responded = true
+			responder(w, r, err)
+		}))
+		core, logs := observer.New(zapcore.DebugLevel)
+		h := Recovery(zap.New(core), false, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.before != nil {
+				tt.before(w)
+			}
+			panic(tt.panicValue)
+		}))
+		w := &hijackRecorder{httptest.NewRecorder()}
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", name, w.Code, tt.wantStatus)
+		}
+		if responded != tt.wantResponded {
+			t.Errorf("%s: responded = %v, want %v", name, responded, tt.wantResponded)
+		}
+		if entries := logs.All(); len(entries) != 1 || entries[0].Message != tt.wantMessage {
+			t.Errorf("%s: log entries = %v, want message %q", name, entries, tt.wantMessage)
+		}
+	}
+}
+
+// hijackRecorder a httptest.ResponseRecorder which can be hijacked.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijacked")
+}
+
+func TestRecoveryFlushedServer(t *testing.T) {
+	var errorLog bytes.Buffer
+	core, _ := observer.New(zapcore.DebugLevel)
+	srv := httptest.NewUnstartedServer(Recovery(zap.New(core), false)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush() // like server-sent events
+			panic("unexpected")
+		})))
+	srv.Config.ErrorLog = log.New(&errorLog, "", 0)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL) // nolint: noctx
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	srv.Close() // flush the server error log
+	if strings.Contains(errorLog.String(), "superfluous") {
+		t.Errorf("unexpected server error log: %s", errorLog.String())
+	}
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Recovery(zap.New(core), false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler { // nolint: errorlint
+			t.Errorf("recover() = %v, want http.ErrAbortHandler", err)
+		}
+		if logs.Len() != 0 {
+			t.Errorf("http.ErrAbortHandler should not be logged")
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestPanicResponders(t *testing.T) {
+	tests := map[string]struct {
+		responder       PanicResponder
+		wantContentType string
+		wantBody        string
+	}{
+		"default": {
+			responder: DefaultPanicResponder,
+		},
+		"json": {
+			responder:       JSONPanicResponder,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `{"code":500,"message":"Internal Server Error"}`,
+		},
+		"problem": {
+			responder:       ProblemPanicResponder,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"instance":"/path","status":500,"title":"Internal Server Error","type":"about:blank"}`,
+		},
+		"html": {
+			responder:       HTMLPanicResponder,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody: "<!DOCTYPE html>\n<html>\n" +
+				"<head><title>500 Internal Server Error</title></head>\n" +
+				"<body><h1>500 Internal Server Error</h1></body>\n</html>\n",
+		},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.responder(w, httptest.NewRequest(http.MethodGet, "/path", nil), "unexpected")
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: status = %d, want %d", name, w.Code, http.StatusInternalServerError)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+			t.Errorf("%s: content type = %q, want %q", name, got, tt.wantContentType)
+		}
+		if tt.wantContentType != "" && w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s: missing X-Content-Type-Options nosniff", name)
+		}
+		if got := w.Body.String(); got != tt.wantBody {
+			t.Errorf("%s: body = %q, want %q", name, got, tt.wantBody)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package gzap
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultCaptureBodyLimit the default max bytes of the captured request and response body.
+const defaultCaptureBodyLimit = 64 << 10
+
+// Runtime the runtime adjustable settings of Logger, which can be changed by the
+// admin handler during incidents. It is safe for concurrent use.
+// The zero value is ready to use, the access log level is info.
+type Runtime struct {
+	levelOnce sync.Once
+	level     zap.AtomicLevel
+	mu        sync.RWMutex
+	captures  []*Capture
+}
+
+// Capture a temporary debug capture, which logs the request headers,
+// request body and response body for the requests with the path prefix until expired,
+// the credential headers like Authorization and Cookie are redacted, see WithRedactedHeaders.
+// The capture is ignored by the Logger with WithFormatter, which logs a single line only.
+type Capture struct {
+	// Prefix the path prefix
+	Prefix string `json:"prefix"`
+	// ExpiresAt the capture expire time
+	ExpiresAt time.Time `json:"expires_at"`
+	// BodyLimit the max bytes of the captured request and response body
+	BodyLimit int `json:"body_limit"`
+}
+
+// NewRuntime returns a Runtime, the access log level is info.
+func NewRuntime() *Runtime {
+	return &Runtime{level: zap.NewAtomicLevel()}
+}
+
+// Level returns the minimum level of the access log entries,
+// the entries below the level are discarded.
+func (rt *Runtime) Level() zap.AtomicLevel {
+	rt.levelOnce.Do(func() {
+		if rt.level == (zap.AtomicLevel{}) {
+			rt.level = zap.NewAtomicLevel()
+		}
+	})
+	return rt.level
+}
+
+// Capture starts a temporary debug capture for the path prefix, which expires after d.
+// bodyLimit <= 0 means the default limit 64KiB.
+// The Logger with WithFormatter ignores the capture.
+// The capture with the same prefix is replaced.
+func (rt *Runtime) Capture(prefix string, d time.Duration, bodyLimit int) {
+	if bodyLimit <= 0 {
+		bodyLimit = defaultCaptureBodyLimit
+	}
+	c := &Capture{prefix, time.Now().Add(d), bodyLimit}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	captures := rt.captures[:0:0]
+	for _, v := range rt.captures {
+		if v.Prefix != prefix && time.Now().Before(v.ExpiresAt) {
+			captures = append(captures, v)
+		}
+	}
+	rt.captures = append(captures, c)
+}
+
+// StopCapture stops all the debug captures.
+func (rt *Runtime) StopCapture() {
+	rt.mu.Lock()
+	rt.captures = nil
+	rt.mu.Unlock()
+}
+
+// Captures returns the active debug captures.
+func (rt *Runtime) Captures() []Capture {
+	now := time.Now()
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	captures := make([]Capture, 0, len(rt.captures))
+	for _, c := range rt.captures {
+		if now.Before(c.ExpiresAt) {
+			captures = append(captures, *c)
+		}
+	}
+	return captures
+}
+
+// match returns the active capture which matches the path, nil if not found.
+func (rt *Runtime) match(path string) *Capture {
+	now := time.Now()
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	for _, c := range rt.captures {
+		if strings.HasPrefix(path, c.Prefix) && now.Before(c.ExpiresAt) {
+			return c
+		}
+	}
+	return nil
+}
+
+// runtimeState the runtime state, used by admin handler.
+type runtimeState struct {
+	Level    string    `json:"level"`
+	Captures []Capture `json:"captures"`
+}
+
+// runtimeRequest the request of admin handler.
+type runtimeRequest struct {
+	Level   *string `json:"level"`
+	Capture *struct {
+		Prefix    string `json:"prefix"`
+		Duration  string `json:"duration"`
+		BodyLimit int    `json:"body_limit"`
+	} `json:"capture"`
+}
+
+// Handler returns the mountable admin handler, which adjusts the runtime settings:
+//
+//	GET    returns the current state, like {"level":"info","captures":[]}
+//	PUT    changes the level or starts a debug capture, like
+//	       {"level":"debug"} or {"capture":{"prefix":"/api","duration":"5m","body_limit":4096}}
+//	DELETE stops all the debug captures
+//
+// The handler should be protected by the authorization middleware.
+func (rt *Runtime) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var req runtimeRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				renderRuntimeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+				return
+			}
+			var lvl zapcore.Level
+			if req.Level != nil {
+				if err := lvl.UnmarshalText([]byte(*req.Level)); err != nil {
+					renderRuntimeError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+			}
+			var d time.Duration
+			if req.Capture != nil {
+				var err error
+				if d, err = time.ParseDuration(req.Capture.Duration); err != nil || d <= 0 {
+					renderRuntimeError(w, http.StatusBadRequest, "invalid capture duration "+req.Capture.Duration)
+					return
+				}
+				if !strings.HasPrefix(req.Capture.Prefix, "/") {
+					renderRuntimeError(w, http.StatusBadRequest, "capture prefix must start with '/'")
+					return
+				}
+			}
+			if req.Level != nil {
+				rt.Level().SetLevel(lvl)
+			}
+			if req.Capture != nil {
+				rt.Capture(req.Capture.Prefix, d, req.Capture.BodyLimit)
+			}
+		case http.MethodDelete:
+			rt.StopCapture()
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			renderRuntimeError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(runtimeState{rt.Level().String(), rt.Captures()})
+	})
+}
+
+func renderRuntimeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    statusCode,
+		"message": message,
+	})
+}
+
+// limitedBuffer a buffer which keeps at most limit bytes, the rest are discarded.
+type limitedBuffer struct {
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - len(b.buf); n < len(p) {
+		b.buf = append(b.buf, p[:n]...)
+		b.truncated = true
+	} else {
+		b.buf = append(b.buf, p...)
+	}
+	return len(p), nil
+}
+
+// captureReader captures the request body read by the handler.
+type captureReader struct {
+	io.ReadCloser
+	buf *limitedBuffer
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	_, _ = c.buf.Write(p[:n])
+	return n, err
+}
+
+// capturing the state of a debug capture request.
+type capturing struct {
+	reqBody  *limitedBuffer
+	respBody *limitedBuffer
+}
+
+// startCapture starts capture the request and response body.
+func startCapture(c *Capture, r *http.Request, ww interface{ Tee(io.Writer) }) *capturing {
+	cp := &capturing{
+		reqBody:  &limitedBuffer{limit: c.BodyLimit},
+		respBody: &limitedBuffer{limit: c.BodyLimit},
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &captureReader{r.Body, cp.reqBody}
+	}
+	ww.Tee(cp.respBody)
+	return cp
+}
+
+// appendFields appends the captured fields, the headers in redacted are redacted.
+func (cp *capturing) appendFields(fields []zap.Field, r *http.Request, redacted map[string]struct{}) []zap.Field {
+	return append(fields,
+		zap.Object("request-headers", redactedHeader{r.Header, redacted}),
+		zap.ByteString("request-body", cp.reqBody.buf),
+		zap.Bool("request-body-truncated", cp.reqBody.truncated),
+		zap.ByteString("response-body", cp.respBody.buf),
+		zap.Bool("response-body-truncated", cp.respBody.truncated),
+	)
+}
+
+// DefaultRedactedHeaders the default credential headers redacted in the debug capture.
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+	"X-Access-Token",
+	"X-Csrf-Token",
+	"X-Xsrf-Token",
+	"X-Amz-Security-Token",
+}
+
+// newHeaderSet returns the set of the canonical header names.
+func newHeaderSet(headers []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(headers))
+	for _, h := range headers {
+		set[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	return set
+}
+
+// redactedHeader the request headers with the credentials redacted.
+type redactedHeader struct {
+	header   http.Header
+	redacted map[string]struct{}
+}
+
+// MarshalLogObject implement zapcore.ObjectMarshaler interface.
+func (h redactedHeader) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for name, v := range h.header {
+		if _, ok := h.redacted[http.CanonicalHeaderKey(name)]; ok {
+			enc.AddString(name, "[REDACTED]")
+		} else {
+			enc.AddString(name, strings.Join(v, ", "))
+		}
+	}
+	return nil
+}
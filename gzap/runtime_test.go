@@ -0,0 +1,178 @@
+package gzap
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRuntime(t *testing.T) {
+	rt := NewRuntime()
+	admin := rt.Handler()
+	doAdmin := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(method, "/admin/log", strings.NewReader(body)))
+		return w
+	}
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core), WithRuntime(rt))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte("response")) // nolint: errcheck
+	}))
+	do := func(path string) {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader("request"))
+		r.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if w := doAdmin(http.MethodPut, `{"level":"warn"}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	do("/api/users")
+	if logs.Len() != 0 {
+		t.Fatalf("info entries should be discarded at warn level")
+	}
+
+	if w := doAdmin(http.MethodPut, `{"capture":{"prefix":"/api","duration":"1m","body_limit":4}}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doAdmin(http.MethodGet, ""); !strings.Contains(w.Body.String(), `"prefix":"/api"`) {
+		t.Errorf("state = %s, want capture /api", w.Body.String())
+	}
+	do("/api/users")
+	do("/other")
+	entries := logs.TakeAll()
+	if len(entries) != 1 {
+		t.Fatalf("log entries = %d, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["request-body"] != "requ" || fields["response-body"] != "resp" ||
+		fields["request-body-truncated"] != true {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if headers := fields["request-headers"].(map[string]interface{}); headers["Authorization"] != "[REDACTED]" {
+		t.Errorf("Authorization should be redacted, got %v", headers["Authorization"])
+	}
+
+	doAdmin(http.MethodDelete, "")
+	do("/api/users")
+	if logs.Len() != 0 {
+		t.Errorf("capture should be stopped")
+	}
+
+	for _, body := range []string{`{"level":"verbose"}`, `{"capture":{"prefix":"/api","duration":"-1m"}}`, `{`} {
+		if w := doAdmin(http.MethodPut, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestRuntimeRedactedHeaders(t *testing.T) {
+	header := map[string]string{
+		"Authorization": "Bearer secret",
+		"X-Api-Key":     "key",
+		"X-Auth-Token":  "token",
+		"X-Csrf-Token":  "csrf",
+		"X-Custom":      "custom",
+		"Accept":        "*/*",
+	}
+	tests := map[string]struct {
+		opts []Option
+		want map[string]interface{}
+	}{
+		"default": {
+			nil,
+			map[string]interface{}{
+				"Authorization": "[REDACTED]",
+				"X-Api-Key":     "[REDACTED]",
+				"X-Auth-Token":  "[REDACTED]",
+				"X-Csrf-Token":  "[REDACTED]",
+				"X-Custom":      "custom",
+				"Accept":        "*/*",
+			},
+		},
+		"custom": {
+			[]Option{WithRedactedHeaders("x-custom")},
+			map[string]interface{}{
+				"Authorization": "Bearer secret",
+				"X-Api-Key":     "key",
+				"X-Auth-Token":  "token",
+				"X-Csrf-Token":  "csrf",
+				"X-Custom":      "[REDACTED]",
+				"Accept":        "*/*",
+			},
+		},
+		"extended": {
+			[]Option{WithRedactedHeaders(append(DefaultRedactedHeaders, "X-Custom")...)},
+			map[string]interface{}{
+				"Authorization": "[REDACTED]",
+				"X-Api-Key":     "[REDACTED]",
+				"X-Auth-Token":  "[REDACTED]",
+				"X-Csrf-Token":  "[REDACTED]",
+				"X-Custom":      "[REDACTED]",
+				"Accept":        "*/*",
+			},
+		},
+	}
+	for name, tt := range tests {
+		rt := NewRuntime()
+		rt.Capture("/", time.Minute, 0)
+		core, logs := observer.New(zapcore.DebugLevel)
+		h := Logger(zap.New(core), append(tt.opts, WithRuntime(rt))...)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		entries := logs.All()
+		if len(entries) != 1 {
+			t.Fatalf("%s: log entries = %d, want 1", name, len(entries))
+		}
+		headers, _ := entries[0].ContextMap()["request-headers"].(map[string]interface{})
+		for k, v := range tt.want {
+			if headers[k] != v {
+				t.Errorf("%s: %s = %v, want %v", name, k, headers[k], v)
+			}
+		}
+	}
+}
+
+func TestRuntimeZeroValue(t *testing.T) {
+	var rt Runtime
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core), WithRuntime(&rt))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if logs.Len() != 1 {
+		t.Errorf("log entries = %d, want 1 at the default info level", logs.Len())
+	}
+
+	w := httptest.NewRecorder()
+	rt.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/log", strings.NewReader(`{"level":"warn"}`)))
+	if w.Code != http.StatusOK || rt.Level().Level() != zapcore.WarnLevel {
+		t.Errorf("status = %d, level = %v, want warn", w.Code, rt.Level().Level())
+	}
+}
+
+func TestRuntimeCaptureWithFormatter(t *testing.T) {
+	rt := NewRuntime()
+	rt.Capture("/", time.Minute, 0)
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core), WithRuntime(rt), WithFormatter(CommonLogFormat))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	entries := logs.All()
+	if len(entries) != 1 || len(entries[0].Context) != 0 {
+		t.Errorf("the capture should be ignored with the formatter, got %v", entries)
+	}
+}
@@ -0,0 +1,286 @@
+package gzap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings the declarative access log settings, which can be loaded from
+// YAML, JSON or environment variables, and maps onto the Options.
+// like YAML:
+//
+//	time_format: RFC3339
+//	utc: true
+//	skip_paths: ["/healthz"]
+//	headers: ["X-Request-Id"]
+//	sample_rate: 0.1
+//	levels:
+//	  4xx: warn
+//	  5xx: error
+//	  404: info
+type Settings struct {
+	// TimeFormat time layout or the name of the time package layout, like "RFC3339".
+	TimeFormat string `json:"time_format" yaml:"time_format"`
+	// UTC whether to use UTC time zone.
+	UTC bool `json:"utc" yaml:"utc"`
+	// SkipPaths the paths which are not logged.
+	SkipPaths []string `json:"skip_paths" yaml:"skip_paths"`
+	// Headers the request headers which are logged.
+	Headers []string `json:"headers" yaml:"headers"`
+	// SampleRate the sample rate in [0, 1], nil means 1.
+	SampleRate *float64 `json:"sample_rate" yaml:"sample_rate"`
+	// Levels the status to log level mapping, the key is a status code like "404"
+	// or a status class like "4xx", the value is the zap level like "warn",
+	// the level above "error" is not allowed.
+	Levels map[string]string `json:"levels" yaml:"levels"`
+}
+
+// SettingsError the invalid setting error, Key is the offending key,
+// like "levels.5xx" or the environment variable name.
+type SettingsError struct {
+	Key string
+	Err error
+}
+
+// Error implement error interface.
+func (e *SettingsError) Error() string {
+	return fmt.Sprintf("gzap: invalid setting %q: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *SettingsError) Unwrap() error { return e.Err }
+
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+}
+
+// LoadSettings loads the settings from the file, the format is determined by
+// the file extension, ".yaml", ".yml" or ".json".
+func LoadSettings(filename string) (*Settings, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSettings(data, strings.TrimPrefix(filepath.Ext(filename), "."))
+}
+
+// ParseSettings parses the settings from data, format is "yaml", "yml" or "json".
+// The unknown keys are rejected.
+func ParseSettings(data []byte, format string) (*Settings, error) {
+	s := &Settings{}
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(s); err != nil {
+			return nil, fmt.Errorf("gzap: decode yaml settings: %w", err)
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(s); err != nil {
+			return nil, fmt.Errorf("gzap: decode json settings: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("gzap: unsupported settings format %q", format)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ApplyEnv overrides the settings from the environment variables with the prefix, like:
+//
+//	{prefix}TIME_FORMAT=RFC3339
+//	{prefix}UTC=true
+//	{prefix}SKIP_PATHS=/healthz,/metrics
+//	{prefix}HEADERS=X-Request-Id,Referer
+//	{prefix}SAMPLE_RATE=0.1
+//	{prefix}LEVELS=4xx=warn,5xx=error
+//
+// The unset environment variables are ignored, the error of an invalid value
+// is a *SettingsError which Key is the environment variable name.
+func (s *Settings) ApplyEnv(prefix string) error {
+	if v, ok := os.LookupEnv(prefix + "TIME_FORMAT"); ok {
+		s.TimeFormat = v
+	}
+	if v, ok := os.LookupEnv(prefix + "UTC"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return &SettingsError{prefix + "UTC", err}
+		}
+		s.UTC = b
+	}
+	if v, ok := os.LookupEnv(prefix + "SKIP_PATHS"); ok {
+		paths := splitList(v)
+		if err := validateEnv(prefix+"SKIP_PATHS", &Settings{SkipPaths: paths}); err != nil {
+			return err
+		}
+		s.SkipPaths = paths
+	}
+	if v, ok := os.LookupEnv(prefix + "HEADERS"); ok {
+		headers := splitList(v)
+		if err := validateEnv(prefix+"HEADERS", &Settings{Headers: headers}); err != nil {
+			return err
+		}
+		s.Headers = headers
+	}
+	if v, ok := os.LookupEnv(prefix + "SAMPLE_RATE"); ok {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return &SettingsError{prefix + "SAMPLE_RATE", err}
+		}
+		if err := validateEnv(prefix+"SAMPLE_RATE", &Settings{SampleRate: &rate}); err != nil {
+			return err
+		}
+		s.SampleRate = &rate
+	}
+	if v, ok := os.LookupEnv(prefix + "LEVELS"); ok {
+		levels := make(map[string]string)
+		for _, kv := range splitList(v) {
+			i := strings.IndexByte(kv, '=')
+			if i < 0 {
+				return &SettingsError{prefix + "LEVELS", fmt.Errorf("missing '=' in %q", kv)}
+			}
+			levels[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+		}
+		if err := validateEnv(prefix+"LEVELS", &Settings{Levels: levels}); err != nil {
+			return err
+		}
+		s.Levels = levels
+	}
+	return s.Validate()
+}
+
+// validateEnv validates the settings parsed from the environment variable key,
+// the error is reported with the key.
+func validateEnv(key string, s *Settings) error {
+	err := s.Validate()
+	var se *SettingsError
+	if errors.As(err, &se) {
+		return &SettingsError{key, fmt.Errorf("%s: %w", se.Key, se.Err)}
+	}
+	return err
+}
+
+// Validate validates the settings, the error is a *SettingsError.
+func (s *Settings) Validate() error {
+	for i, path := range s.SkipPaths {
+		if !strings.HasPrefix(path, "/") {
+			return &SettingsError{fmt.Sprintf("skip_paths[%d]", i), fmt.Errorf("path %q must start with '/'", path)}
+		}
+	}
+	for i, h := range s.Headers {
+		if h == "" || strings.ContainsAny(h, " \t:") {
+			return &SettingsError{fmt.Sprintf("headers[%d]", i), fmt.Errorf("invalid header name %q", h)}
+		}
+	}
+	if s.SampleRate != nil && (*s.SampleRate < 0 || *s.SampleRate > 1) {
+		return &SettingsError{"sample_rate", fmt.Errorf("%v out of range [0, 1]", *s.SampleRate)}
+	}
+	_, err := s.statusLevel()
+	return err
+}
+
+// Options maps the settings onto the Options.
+func (s *Settings) Options() ([]Option, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if s.TimeFormat != "" {
+		layout := s.TimeFormat
+		if v, ok := timeLayouts[layout]; ok {
+			layout = v
+		}
+		opts = append(opts, WithTimeFormat(layout))
+	}
+	opts = append(opts, WithUTC(s.UTC))
+	if len(s.SkipPaths) > 0 {
+		opts = append(opts, WithSkipPaths(s.SkipPaths...))
+	}
+	if len(s.Headers) > 0 {
+		opts = append(opts, WithRequestHeaders(s.Headers...))
+	}
+	if s.SampleRate != nil {
+		opts = append(opts, WithSampleRate(*s.SampleRate))
+	}
+	statusLevel, _ := s.statusLevel()
+	if statusLevel != nil {
+		opts = append(opts, WithStatusLevel(statusLevel))
+	}
+	return opts, nil
+}
+
+// statusLevel returns the status to level mapping function, nil if no levels.
+func (s *Settings) statusLevel() (func(status int) zapcore.Level, error) {
+	if len(s.Levels) == 0 {
+		return nil, nil
+	}
+	codes := make(map[int]zapcore.Level)
+	classes := make(map[int]zapcore.Level)
+	for key, value := range s.Levels {
+		var lvl zapcore.Level
+		if err := lvl.UnmarshalText([]byte(value)); err != nil {
+			return nil, &SettingsError{"levels." + key, err}
+		}
+		// dpanic, panic and fatal would crash the process on a response.
+		if lvl > zapcore.ErrorLevel {
+			return nil, &SettingsError{"levels." + key, fmt.Errorf("level %q above error is not allowed", value)}
+		}
+		if len(key) == 3 && key[0] >= '1' && key[0] <= '5' && strings.EqualFold(key[1:], "xx") {
+			classes[int(key[0]-'0')] = lvl
+			continue
+		}
+		code, err := strconv.Atoi(key)
+		if err != nil || code < 100 || code > 599 {
+			return nil, &SettingsError{"levels." + key, fmt.Errorf("key must be a status code or class like 4xx")}
+		}
+		codes[code] = lvl
+	}
+	return func(status int) zapcore.Level {
+		if lvl, ok := codes[status]; ok {
+			return lvl
+		}
+		if lvl, ok := classes[status/100]; ok {
+			return lvl
+		}
+		return zapcore.InfoLevel
+	}, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
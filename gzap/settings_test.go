@@ -0,0 +1,140 @@
+package gzap
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseSettings(t *testing.T) {
+	yamlData := []byte(`
+time_format: RFC3339
+utc: true
+skip_paths: ["/healthz"]
+headers: ["X-Request-Id"]
+sample_rate: 1
+levels:
+  4xx: warn
+  404: info
+  5xx: error
+`)
+	s, err := ParseSettings(yamlData, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := s.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Logger(zap.New(core), opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	for _, path := range []string{"/healthz", "/missing", "/bad"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-Request-Id", "abc")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("log entries = %d, want 2", len(entries))
+	}
+	if entries[0].Level != zapcore.InfoLevel || entries[1].Level != zapcore.WarnLevel {
+		t.Errorf("levels = %v, %v, want info, warn", entries[0].Level, entries[1].Level)
+	}
+	headers, _ := entries[0].ContextMap()["headers"].(map[string]interface{})
+	if headers["X-Request-Id"] != "abc" {
+		t.Errorf("headers = %v", headers)
+	}
+
+	// json
+	if _, err = ParseSettings([]byte(`{"utc":true,"skip_paths":["/metrics"]}`), "json"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSettingsError(t *testing.T) {
+	tests := map[string]struct {
+		data    string
+		format  string
+		wantKey string
+	}{
+		"invalid level":     {`{"levels":{"5xx":"fatalx"}}`, "json", "levels.5xx"},
+		"invalid level key": {"levels:\n  6xx: warn\n", "yaml", "levels.6xx"},
+		"fatal level":       {"levels:\n  5xx: fatal\n", "yaml", "levels.5xx"},
+		"panic level":       {`{"levels":{"4xx":"panic"}}`, "json", "levels.4xx"},
+		"dpanic level":      {`{"levels":{"500":"dpanic"}}`, "json", "levels.500"},
+		"sample rate":       {`{"sample_rate":2}`, "json", "sample_rate"},
+		"skip path":         {"skip_paths: [healthz]\n", "yaml", "skip_paths[0]"},
+		"header":            {`{"headers":["X-A", "bad header"]}`, "json", "headers[1]"},
+	}
+	for name, tt := range tests {
+		_, err := ParseSettings([]byte(tt.data), tt.format)
+		var se *SettingsError
+		if !errors.As(err, &se) || se.Key != tt.wantKey {
+			t.Errorf("%s: error = %v, want key %q", name, err, tt.wantKey)
+		}
+	}
+
+	if _, err := ParseSettings([]byte("unknown: 1\n"), "yaml"); err == nil {
+		t.Error("unknown key should fail")
+	}
+}
+
+func TestSettingsApplyEnv(t *testing.T) {
+	os.Setenv("GZAP_TEST_SAMPLE_RATE", "0.5")  // nolint: errcheck
+	os.Setenv("GZAP_TEST_LEVELS", "5xx=error") // nolint: errcheck
+	defer os.Unsetenv("GZAP_TEST_SAMPLE_RATE") // nolint: errcheck
+	defer os.Unsetenv("GZAP_TEST_LEVELS")      // nolint: errcheck
+
+	s := &Settings{}
+	if err := s.ApplyEnv("GZAP_TEST_"); err != nil {
+		t.Fatal(err)
+	}
+	if s.SampleRate == nil || *s.SampleRate != 0.5 || s.Levels["5xx"] != "error" {
+		t.Errorf("unexpected settings %+v", s)
+	}
+
+	os.Setenv("GZAP_TEST_UTC", "yes")  // nolint: errcheck
+	defer os.Unsetenv("GZAP_TEST_UTC") // nolint: errcheck
+	var se *SettingsError
+	if err := s.ApplyEnv("GZAP_TEST_"); !errors.As(err, &se) || se.Key != "GZAP_TEST_UTC" {
+		t.Errorf("error = %v, want key GZAP_TEST_UTC", err)
+	}
+}
+
+func TestSettingsApplyEnvError(t *testing.T) {
+	tests := map[string]struct {
+		name  string
+		value string
+	}{
+		"sample rate out of range": {"GZAP_ENV_SAMPLE_RATE", "2"},
+		"sample rate not a number": {"GZAP_ENV_SAMPLE_RATE", "half"},
+		"level":                    {"GZAP_ENV_LEVELS", "5xx=fatal"},
+		"level key":                {"GZAP_ENV_LEVELS", "6xx=warn"},
+		"level missing '='":        {"GZAP_ENV_LEVELS", "5xx"},
+		"skip path":                {"GZAP_ENV_SKIP_PATHS", "/metrics,healthz"},
+		"header":                   {"GZAP_ENV_HEADERS", "bad header"},
+	}
+	for name, tt := range tests {
+		os.Setenv(tt.name, tt.value) // nolint: errcheck
+		err := (&Settings{}).ApplyEnv("GZAP_ENV_")
+		os.Unsetenv(tt.name) // nolint: errcheck
+		var se *SettingsError
+		if !errors.As(err, &se) || se.Key != tt.name {
+			t.Errorf("%s: error = %v, want key %q", name, err, tt.name)
+		}
+	}
+}
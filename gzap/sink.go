@@ -0,0 +1,38 @@
+package gzap
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Sink the logging sink used by Logger and Recovery,
+// so the same access log and recovery semantics can be shared regardless of the logger.
+// see ZapSink and the slog implementation in package gslog.
+type Sink interface {
+	// Log logs a message at the level with the fields.
+	// The fields slice is reused after Log returns, it must not be retained.
+	Log(lvl zapcore.Level, msg string, fields ...zap.Field)
+}
+
+// SinkFunc is an adapter to allow the use of ordinary functions as Sink.
+type SinkFunc func(lvl zapcore.Level, msg string, fields ...zap.Field)
+
+// Log implement Sink interface.
+func (f SinkFunc) Log(lvl zapcore.Level, msg string, fields ...zap.Field) {
+	f(lvl, msg, fields...)
+}
+
+// ZapSink returns a Sink which logs using uber-go/zap.
+func ZapSink(logger *zap.Logger) Sink {
+	return zapSink{logger}
+}
+
+type zapSink struct {
+	logger *zap.Logger
+}
+
+func (z zapSink) Log(lvl zapcore.Level, msg string, fields ...zap.Field) {
+	if ce := z.logger.Check(lvl, msg); ce != nil {
+		ce.Write(fields...)
+	}
+}
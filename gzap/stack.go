@@ -0,0 +1,96 @@
+package gzap
+
+import (
+	"runtime"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Frame a stack frame.
+type Frame struct {
+	// Function the package path-qualified function name
+	Function string
+	// File the file path
+	File string
+	// Line the line number
+	Line int
+}
+
+// MarshalLogObject implement zapcore.ObjectMarshaler interface.
+func (f Frame) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("func", f.Function)
+	enc.AddString("file", f.File)
+	enc.AddInt("line", f.Line)
+	return nil
+}
+
+// Frames stack frames.
+type Frames []Frame
+
+// MarshalLogArray implement zapcore.ArrayMarshaler interface.
+func (fs Frames) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, f := range fs {
+		if err := enc.AppendObject(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StackFilter reports whether to keep the frame in the structured stack.
+type StackFilter func(f Frame) bool
+
+// gzapPackage the package path of this package, used to filter the middleware frames.
+var gzapPackage = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	i := strings.LastIndex(name, "/")
+	return name[:i+strings.Index(name[i:], ".")+1]
+}()
+
+// DefaultStackFilter filter out the runtime, net/http and this middleware frames.
+func DefaultStackFilter(f Frame) bool {
+	return !strings.HasPrefix(f.Function, "runtime.") &&
+		!strings.HasPrefix(f.Function, "runtime/debug.") &&
+		!strings.HasPrefix(f.Function, "net/http.") &&
+		!strings.HasPrefix(f.Function, gzapPackage)
+}
+
+// panicFrames returns the frames of the current goroutine from where the panic occurred,
+// it must be called in the deferred function which recovered from the panic.
+// The frames are filtered by the filter if not nil, and truncated to maxDepth if maxDepth > 0.
+func panicFrames(filter StackFilter, maxDepth int) Frames {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(2, pcs)
+		if n < len(pcs) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, len(pcs)*2)
+	}
+
+	var frames Frames
+	var found bool
+	it := runtime.CallersFrames(pcs)
+	for {
+		frame, more := it.Next()
+		if found {
+			f := Frame{frame.Function, frame.File, frame.Line}
+			if filter == nil || filter(f) {
+				frames = append(frames, f)
+				if maxDepth > 0 && len(frames) >= maxDepth {
+					break
+				}
+			}
+		} else if frame.Function == "runtime.gopanic" {
+			// skip the frames of the deferred function and the runtime panic.
+			found = true
+		}
+		if !more {
+			break
+		}
+	}
+	return frames
+}
@@ -0,0 +1,56 @@
+package gzap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestStructuredStack(t *testing.T) {
+	if gzapPackage != "github.com/thinkgos/http-middlewares/gzap." {
+		t.Fatalf("gzapPackage = %q", gzapPackage)
+	}
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := Recovery(zap.New(core), true,
+		WithStructuredStack(true),
+		WithStackMaxDepth(2),
+		WithStackFilter(func(f Frame) bool { return !strings.HasPrefix(f.Function, "runtime.") }),
+	)(http.HandlerFunc(panicA))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("log entries = %d, want 1", len(entries))
+	}
+	stack, ok := entries[0].ContextMap()["stack"].([]interface{})
+	if !ok || len(stack) != 2 {
+		t.Fatalf("stack = %v, want 2 frames", entries[0].ContextMap()["stack"])
+	}
+	top := stack[0].(map[string]interface{})
+	if top["func"] != "github.com/thinkgos/http-middlewares/gzap.panicA" ||
+		!strings.HasSuffix(top["file"].(string), "hook_test.go") {
+		t.Errorf("top frame = %v, want gzap.panicA", top)
+	}
+}
+
+func TestDefaultStackFilter(t *testing.T) {
+	tests := map[string]bool{
+		"runtime.gopanic":                           false,
+		"runtime/debug.Stack":                       false,
+		"net/http.HandlerFunc.ServeHTTP":            false,
+		gzapPackage + "Recovery.func1.1":            false,
+		"main.handler":                              true,
+		"github.com/go-chi/chi/v5.(*Mux).routeHTTP": true,
+	}
+	for fn, want := range tests {
+		if got := DefaultStackFilter(Frame{Function: fn}); got != want {
+			t.Errorf("DefaultStackFilter(%s) = %v, want %v", fn, got, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package gzap
+
+import (
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// slowWatchdog logs a warning if the request is still in flight after the threshold.
+type slowWatchdog struct {
+	timer *time.Timer
+	fired int32
+}
+
+// watchSlowRequest starts a slow request watchdog, the request fields are extracted
+// before the handler, so the watchdog never touch the request concurrently with the handler.
+func watchSlowRequest(sink Sink, cfg *Config, r *http.Request, start time.Time, path, query string) *slowWatchdog {
+	fields := requestFields(cfg, r, path, query)
+	wd := &slowWatchdog{}
+	wd.timer = time.AfterFunc(cfg.slowThreshold, func() {
+		atomic.StoreInt32(&wd.fired, 1)
+		fields = append(fields, zap.Duration("elapsed", time.Since(start)))
+		if cfg.slowDump {
+			fields = append(fields, zap.ByteString("goroutines", goroutineDump()))
+		}
+		sink.Log(zapcore.WarnLevel, "[Slow request in flight]", fields...)
+	})
+	return wd
+}
+
+// Stop stops the watchdog, and reports whether the watchdog has fired.
+func (wd *slowWatchdog) Stop() bool {
+	wd.timer.Stop()
+	return atomic.LoadInt32(&wd.fired) == 1
+}
+
+// goroutineDump returns the stack traces of all goroutines.
+func goroutineDump() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		if len(buf) >= 64<<20 {
+			// too large, truncated.
+			return buf
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
@@ -0,0 +1,99 @@
+package gzap
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// sentWriter records whether the response header has been sent, which is
+// WriteHeader, Write, ReadFrom, Flush or Hijack called, chi's WrapResponseWriter
+// leaves the status 0 on Flush and Hijack.
+type sentWriter struct {
+	http.ResponseWriter
+	sent bool
+}
+
+// newSentWriter wraps w, the returned writer keeps the same optional interfaces
+// which chi's middleware.NewWrapResponseWriter looks for.
+func newSentWriter(w http.ResponseWriter, protoMajor int) (http.ResponseWriter, *sentWriter) {
+	sw := &sentWriter{ResponseWriter: w}
+	_, fl := w.(http.Flusher)
+	if protoMajor == 2 {
+		if _, ps := w.(http.Pusher); fl && ps {
+			return &http2SentWriter{sw}, sw
+		}
+	} else {
+		_, hj := w.(http.Hijacker)
+		_, rf := w.(io.ReaderFrom)
+		if fl && hj && rf {
+			return &fancySentWriter{sw}, sw
+		}
+		if fl && hj {
+			return &flushHijackSentWriter{sw}, sw
+		}
+		if hj {
+			return &hijackSentWriter{sw}, sw
+		}
+	}
+	if fl {
+		return &flushSentWriter{sw}, sw
+	}
+	return sw, sw
+}
+
+func (w *sentWriter) WriteHeader(code int) {
+	w.sent = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sentWriter) Write(b []byte) (int, error) {
+	w.sent = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sentWriter) flush() {
+	w.sent = true
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *sentWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.sent = true
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (w *sentWriter) readFrom(r io.Reader) (int64, error) {
+	w.sent = true
+	return w.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+}
+
+type flushSentWriter struct{ *sentWriter }
+
+func (w *flushSentWriter) Flush() { w.flush() }
+
+type hijackSentWriter struct{ *sentWriter }
+
+func (w *hijackSentWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+type flushHijackSentWriter struct{ *sentWriter }
+
+func (w *flushHijackSentWriter) Flush() { w.flush() }
+
+func (w *flushHijackSentWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+type fancySentWriter struct{ *sentWriter }
+
+func (w *fancySentWriter) Flush() { w.flush() }
+
+func (w *fancySentWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+func (w *fancySentWriter) ReadFrom(r io.Reader) (int64, error) { return w.readFrom(r) }
+
+type http2SentWriter struct{ *sentWriter }
+
+func (w *http2SentWriter) Flush() { w.flush() }
+
+func (w *http2SentWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
@@ -8,7 +8,10 @@ import (
 
 func ClientIP(r *http.Request) string {
 	clientIP := r.Header.Get("X-Forwarded-For")
-	clientIP = strings.TrimSpace(strings.Split(clientIP, ",")[0])
+	if i := strings.IndexByte(clientIP, ','); i >= 0 {
+		clientIP = clientIP[:i]
+	}
+	clientIP = strings.TrimSpace(clientIP)
 	if clientIP == "" {
 		clientIP = strings.TrimSpace(r.Header.Get("X-Real-Ip"))
 	}
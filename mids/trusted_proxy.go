@@ -0,0 +1,97 @@
+package mids
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies resolves the client ip which is aware of the trusted proxies,
+// the X-Forwarded-For and X-Real-Ip headers are only trusted
+// when the request comes from a trusted proxy, so the client ip can't be spoofed.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// NewTrustedProxies returns the TrustedProxies with the trusted proxy CIDRs,
+// like "10.0.0.0/8", a single ip like "127.0.0.1" is also supported.
+func NewTrustedProxies(cidrs ...string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			t.nets = append(t.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		t.nets = append(t.nets, ipNet)
+	}
+	return t, nil
+}
+
+// IsTrusted reports whether the ip is a trusted proxy.
+func (t *TrustedProxies) IsTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range t.nets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client ip of the request.
+// If the remote address is not a trusted proxy, it is the client ip.
+// Otherwise the X-Forwarded-For is walked from right to left, the first
+// untrusted ip is the client ip, then the X-Real-Ip is used if X-Forwarded-For is empty.
+func (t *TrustedProxies) ClientIP(r *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		return ""
+	}
+	if !t.IsTrusted(remoteIP) {
+		return remoteIP
+	}
+
+	var forwarded []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(v, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				forwarded = append(forwarded, ip)
+			}
+		}
+	}
+	if len(forwarded) > 0 {
+		clientIP := remoteIP
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			ip := forwarded[i]
+			if net.ParseIP(ip) == nil {
+				// the invalid ip can't be trusted, stop at the last valid hop.
+				break
+			}
+			clientIP = ip
+			if !t.IsTrusted(ip) {
+				break
+			}
+		}
+		return clientIP
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-Ip")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return remoteIP
+}
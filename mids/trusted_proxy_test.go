@@ -0,0 +1,70 @@
+package mids
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	proxies, err := NewTrustedProxies("10.0.0.0/8", "127.0.0.1", "::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("invalid cidr should fail")
+	}
+	if _, err = NewTrustedProxies("localhost"); err == nil {
+		t.Error("invalid ip should fail")
+	}
+
+	tests := map[string]struct {
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		"untrusted remote ignores headers": {
+			"1.2.3.4:1234",
+			map[string]string{"X-Forwarded-For": "8.8.8.8", "X-Real-Ip": "8.8.4.4"},
+			"1.2.3.4",
+		},
+		"trusted remote without headers": {
+			"10.0.0.1:1234", nil, "10.0.0.1",
+		},
+		"trusted remote with forwarded": {
+			"10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "8.8.8.8"},
+			"8.8.8.8",
+		},
+		"spoofed forwarded prefix": {
+			"127.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "6.6.6.6, 8.8.8.8, 10.1.1.1"},
+			"8.8.8.8",
+		},
+		"all trusted": {
+			"10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			"10.0.0.3",
+		},
+		"invalid forwarded": {
+			"10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "<script>, 10.0.0.2"},
+			"10.0.0.2",
+		},
+		"trusted remote with real ip": {
+			"[::1]:1234",
+			map[string]string{"X-Real-Ip": "8.8.4.4"},
+			"8.8.4.4",
+		},
+	}
+	for name, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := proxies.ClientIP(r); got != tt.want {
+			t.Errorf("%s: ClientIP() = %q, want %q", name, got, tt.want)
+		}
+	}
+}
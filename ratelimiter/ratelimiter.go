@@ -5,20 +5,20 @@ import (
 
 	"github.com/didip/tollbooth/v6"
 	"github.com/didip/tollbooth/v6/limiter"
+
+	"github.com/thinkgos/http-middlewares/requestid"
 )
 
 // RateLimit rate limit
+// The rejected request is rendered by requestid.RenderJSONError with the limiter message,
+// so the body is json and carries the request id, the limiter's message content type
+// (SetMessageContentType) is not used.
 func RateLimit(lmt *limiter.Limiter) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			httpError := tollbooth.LimitByRequest(lmt, w, r)
 			if httpError != nil {
-				w.Header().Add("", lmt.GetMessageContentType())
-				w.WriteHeader(httpError.StatusCode)
-				_, err := w.Write([]byte(httpError.Message))
-				if err != nil {
-					panic(err)
-				}
+				requestid.RenderJSONError(w, r, httpError.StatusCode, httpError.Message)
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -0,0 +1,41 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/didip/tollbooth/v6"
+
+	"github.com/thinkgos/http-middlewares/requestid"
+)
+
+func TestRateLimit(t *testing.T) {
+	lmt := tollbooth.NewLimiter(1, nil)
+	lmt.SetMessageContentType("text/plain; charset=utf-8")
+	h := requestid.RequestID(requestid.WithNextRequestID(func() string { return "req-1" }))(
+		RateLimit(lmt)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("content type = %q, want json", ct)
+	}
+	var body requestid.ErrorBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json body %s: %v", w.Body.String(), err)
+	}
+	if body.Code != http.StatusTooManyRequests || body.Message != lmt.GetMessage() || body.RequestID != "req-1" {
+		t.Errorf("unexpected body %+v", body)
+	}
+}
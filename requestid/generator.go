@@ -0,0 +1,225 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NextUUIDv4 generates a random UUID version 4 request id, like:
+//
+//	9f0c8b5e-3c1a-4d2e-8f4b-6a7c9d0e1f23
+func NextUUIDv4() string {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // variant RFC 4122
+	return formatUUID(u)
+}
+
+// uuidV7 the state of the monotonic UUID version 7 generator.
+var uuidV7 struct {
+	mu     sync.Mutex
+	lastMs int64
+	seq    uint16
+}
+
+// NextUUIDv7 generates a time-ordered UUID version 7 request id, which is sortable
+// across hosts by the millisecond timestamp, like:
+//
+//	01890a5d-ac96-774b-bcce-b302099a8057
+//
+// the 12 bits rand_a is a counter within the same millisecond, so the ids
+// generated by this process are strictly monotonic.
+func NextUUIDv7() string {
+	var u [16]byte
+	_, _ = rand.Read(u[8:])
+
+	uuidV7.mu.Lock()
+	ms := time.Now().UnixNano() / int64(time.Millisecond)
+	if ms > uuidV7.lastMs {
+		uuidV7.lastMs = ms
+		// start with a random counter, leave room for increments.
+		uuidV7.seq = binary.BigEndian.Uint16(u[8:10]) & 0x01ff
+	} else {
+		uuidV7.seq++
+		if uuidV7.seq > 0x0fff {
+			// counter overflow, borrow the next millisecond.
+			uuidV7.lastMs++
+			uuidV7.seq = 0
+		}
+		ms = uuidV7.lastMs
+	}
+	seq := uuidV7.seq
+	uuidV7.mu.Unlock()
+
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	u[6] = 0x70 | byte(seq>>8) // version 7
+	u[7] = byte(seq)
+	u[8] = u[8]&0x3f | 0x80 // variant RFC 4122
+	return formatUUID(u)
+}
+
+func formatUUID(u [16]byte) string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// crockford the Crockford's base32 alphabet used by ULID.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulid the state of the monotonic ULID generator.
+var ulid struct {
+	mu      sync.Mutex
+	lastMs  int64
+	entropy [10]byte
+}
+
+// NextULID generates a ULID request id, which is 26 characters,
+// lexicographically sortable by the millisecond timestamp, like:
+//
+//	01ARZ3NDEKTSV4RRFFQ69G5FAV
+//
+// the random part is incremented within the same millisecond, so the ids
+// generated by this process are strictly monotonic.
+func NextULID() string {
+	var id [16]byte
+
+	ulid.mu.Lock()
+	ms := time.Now().UnixNano() / int64(time.Millisecond)
+	if ms > ulid.lastMs {
+		ulid.lastMs = ms
+		_, _ = rand.Read(ulid.entropy[:])
+	} else {
+		ms = ulid.lastMs
+		// increment the 80 bits entropy, borrow the next millisecond if overflow.
+		i := len(ulid.entropy) - 1
+		for ; i >= 0; i-- {
+			ulid.entropy[i]++
+			if ulid.entropy[i] != 0 {
+				break
+			}
+		}
+		if i < 0 {
+			ulid.lastMs++
+			ms = ulid.lastMs
+		}
+	}
+	copy(id[6:], ulid.entropy[:])
+	ulid.mu.Unlock()
+
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	return encodeULID(id)
+}
+
+// encodeULID encodes the 128 bits id with Crockford's base32, 26 characters.
+func encodeULID(id [16]byte) string {
+	var b [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	// 26*5 = 130 bits, the first character holds the top 3 bits.
+	for i := 25; i >= 0; i-- {
+		b[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b[:])
+}
+
+// ksuidEpoch the KSUID epoch, 2014-05-13T16:53:20Z.
+const ksuidEpoch = 1400000000
+
+// base62 the alphabet of KSUID.
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var bigBase62 = big.NewInt(62)
+
+// NextKSUID generates a KSUID request id, which is 27 characters,
+// roughly sortable by the second timestamp, like:
+//
+//	0ujtsYcgvSTl8PAuAdqWYSMnLOv
+func NextKSUID() string {
+	var id [20]byte
+	binary.BigEndian.PutUint32(id[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	_, _ = rand.Read(id[4:])
+
+	var b [27]byte
+	n := new(big.Int).SetBytes(id[:])
+	mod := new(big.Int)
+	for i := len(b) - 1; i >= 0; i-- {
+		n.DivMod(n, bigBase62, mod)
+		b[i] = base62[mod.Int64()]
+	}
+	return string(b[:])
+}
+
+// snowflake layout: 41 bits millisecond since the epoch, 10 bits node, 12 bits sequence.
+const (
+	snowflakeEpoch    = 1288834974657 // the Twitter snowflake epoch in milliseconds
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+// ErrInvalidNode the snowflake node id is out of range.
+var ErrInvalidNode = errors.New("requestid: snowflake node id must be in [0, 1023]")
+
+// NewSnowflake returns a Snowflake-style request id generator with the node id in [0, 1023],
+// the id is a decimal 64 bits integer, which is sortable by the millisecond timestamp, like:
+//
+//	1541815603606036480
+//
+// The node id must be unique across the hosts.
+func NewSnowflake(node int64) (func() string, error) {
+	if node < 0 || node > snowflakeMaxNode {
+		return nil, ErrInvalidNode
+	}
+	var (
+		mu     sync.Mutex
+		lastMs int64
+		seq    int64
+	)
+	return func() string {
+		mu.Lock()
+		ms := time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+		if ms > lastMs {
+			lastMs = ms
+			seq = 0
+		} else {
+			seq = (seq + 1) & snowflakeMaxSeq
+			if seq == 0 {
+				// sequence exhausted, borrow the next millisecond.
+				lastMs++
+			}
+			ms = lastMs
+		}
+		id := ms<<(snowflakeNodeBits+snowflakeSeqBits) | node<<snowflakeSeqBits | seq
+		mu.Unlock()
+		return strconv.FormatInt(id, 10)
+	}, nil
+}
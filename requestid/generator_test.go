@@ -0,0 +1,104 @@
+package requestid
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func testGenerator(t *testing.T, name string, next func() string, pattern *regexp.Regexp, sortable bool) {
+	const goroutines, count = 8, 5000
+
+	var mu sync.Mutex
+	seen := make(map[string]struct{}, goroutines*count)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids := make([]string, 0, count)
+			for i := 0; i < count; i++ {
+				ids = append(ids, next())
+			}
+			if sortable && !sort.StringsAreSorted(ids) {
+				t.Errorf("%s: ids generated by a goroutine are not sorted", name)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				if !pattern.MatchString(id) {
+					t.Errorf("%s: id %q does not match %s", name, id, pattern)
+				}
+				if _, ok := seen[id]; ok {
+					t.Errorf("%s: duplicated id %q", name, id)
+				}
+				seen[id] = struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGenerators(t *testing.T) {
+	snowflake, err := NewSnowflake(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewSnowflake(1024); err != ErrInvalidNode {
+		t.Errorf("NewSnowflake(1024) error = %v, want ErrInvalidNode", err)
+	}
+
+	testGenerator(t, "UUIDv4", NextUUIDv4,
+		regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), false)
+	testGenerator(t, "UUIDv7", NextUUIDv7,
+		regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), true)
+	testGenerator(t, "ULID", NextULID, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`), true)
+	testGenerator(t, "KSUID", NextKSUID, regexp.MustCompile(`^[0-9A-Za-z]{27}$`), false)
+	// the decimal snowflake ids have the same length for decades.
+	testGenerator(t, "Snowflake", snowflake, regexp.MustCompile(`^[0-9]{19}$`), true)
+}
+
+func TestEncodeULID(t *testing.T) {
+	var max [16]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+	if got := encodeULID(max); got != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("encodeULID(max) = %s", got)
+	}
+	if got := encodeULID([16]byte{}); got != "00000000000000000000000000" {
+		t.Errorf("encodeULID(zero) = %s", got)
+	}
+}
+
+func BenchmarkNextUUIDv4(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NextUUIDv4()
+	}
+}
+
+func BenchmarkNextUUIDv7(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NextUUIDv7()
+	}
+}
+
+func BenchmarkNextULID(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NextULID()
+	}
+}
+
+func BenchmarkNextKSUID(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NextKSUID()
+	}
+}
+
+func BenchmarkSnowflake(b *testing.B) {
+	next, _ := NewSnowflake(1)
+	for i := 0; i < b.N; i++ {
+		next()
+	}
+}
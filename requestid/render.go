@@ -0,0 +1,33 @@
+package requestid
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorBody the json error body, the request id is omitted if not present.
+type ErrorBody struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// RenderJSONError write the status code with a json error body which carries the request id
+// of the request context, so the client can correlate the error with the server log, like:
+//
+//	{"code":403,"message":"Permission denied!","request_id":"host-1-aBcD-000000000001"}
+func RenderJSONError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	content, err := json.Marshal(ErrorBody{
+		Code:      code,
+		Message:   message,
+		RequestID: FromRequestID(r.Context()),
+	})
+	if err != nil {
+		w.WriteHeader(code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	_, _ = w.Write(content)
+}
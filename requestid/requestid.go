@@ -11,21 +11,74 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	mrand "math/rand"
+	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
 	"sync/atomic"
+
+	"github.com/thinkgos/http-middlewares/mids"
 )
 
 // Key to use when setting the request ID.
 type ctxRequestIDKey struct{}
 
+// requestIDValue the request id and the header it came from.
+type requestIDValue struct {
+	id     string
+	header string
+}
+
 // Config defines the config for RequestID middleware
 type Config struct {
 	requestIDHeader string
 	nextRequestID   func() string
+	// validation
+	maxLength     int
+	pattern       *regexp.Regexp
+	sanitizeChars string
+	invalidPolicy InvalidPolicy
+	invalidPrefix string
+	// echo and trust
+	echo             Echo
+	trustedProxies   *mids.TrustedProxies
+	setRequestHeader bool
+	incomingHeaders  []string
+	responseHeaders  []string
 }
 
+// Echo the echo behavior of the request id in the response header.
+type Echo int
+
+// echo behaviors
+const (
+	// EchoAlways always echoes the request id in the response header.
+	EchoAlways Echo = iota
+	// EchoGenerated only echoes the request id which is generated by this service.
+	EchoGenerated
+	// EchoNever never echoes the request id.
+	EchoNever
+)
+
+// InvalidPolicy the policy for the invalid incoming request id.
+type InvalidPolicy int
+
+// invalid request id policies
+const (
+	// InvalidReplace replaces the invalid request id with a new generated one.
+	InvalidReplace InvalidPolicy = iota
+	// InvalidReject rejects the request with 400 Bad Request.
+	InvalidReject
+	// InvalidPrefix keeps the sanitized request id with a prefix, which marks it untrusted,
+	// the characters which are not visible ASCII or not in WithSanitizeChars are removed,
+	// and the sanitized part is truncated so the prefixed id fits the max length.
+	// If nothing is left after sanitization, or the prefix leaves no room within
+	// the max length, it is replaced with a new generated one.
+	InvalidPrefix
+)
+
 // Option RequestID option
 type Option func(*Config)
 
@@ -43,46 +96,285 @@ func WithNextRequestID(nextRequestID func() string) Option {
 	}
 }
 
+// WithMaxLength optional the max length of the incoming request id,
+// <= 0 means no limit. (default 128)
+func WithMaxLength(n int) Option {
+	return func(c *Config) {
+		c.maxLength = n
+	}
+}
+
+// WithAllowedPattern optional the pattern which the whole incoming request id must match,
+// like regexp.MustCompile(`^[a-zA-Z0-9-]+$`), it is an extra restriction, the request id
+// must always contain only the visible ASCII characters. (default nil)
+func WithAllowedPattern(re *regexp.Regexp) Option {
+	return func(c *Config) {
+		c.pattern = re
+	}
+}
+
+// WithSanitizeChars optional the characters which are kept by the InvalidPrefix policy,
+// like "abcdefghijklmnopqrstuvwxyz0123456789-", empty means all the visible ASCII characters.
+// The whole-string WithAllowedPattern can not be applied to a single character,
+// so it is not used by sanitization. (default "")
+func WithSanitizeChars(chars string) Option {
+	return func(c *Config) {
+		c.sanitizeChars = chars
+	}
+}
+
+// WithInvalidPolicy optional the policy for the invalid incoming request id. (default InvalidReplace)
+func WithInvalidPolicy(p InvalidPolicy) Option {
+	return func(c *Config) {
+		c.invalidPolicy = p
+	}
+}
+
+// WithInvalidPrefix optional the prefix of the invalid request id,
+// only valid for InvalidPrefix policy. (default "untrusted-")
+func WithInvalidPrefix(prefix string) Option {
+	return func(c *Config) {
+		c.invalidPrefix = prefix
+	}
+}
+
+// WithEcho optional the echo behavior of the request id in the response header. (default EchoAlways)
+func WithEcho(e Echo) Option {
+	return func(c *Config) {
+		c.echo = e
+	}
+}
+
+// WithTrustedProxies optional only trust the incoming request id from the trusted proxies,
+// a fresh request id is always generated for the untrusted clients.
+// nil means trust all the clients. (default nil)
+func WithTrustedProxies(t *mids.TrustedProxies) Option {
+	return func(c *Config) {
+		c.trustedProxies = t
+	}
+}
+
+// WithSetRequestHeader optional also set the request id on the incoming request header
+// if it is generated or replaced, so the downstream middleware and proxies like
+// httputil.ReverseProxy carry the same id. (default false)
+func WithSetRequestHeader(b bool) Option {
+	return func(c *Config) {
+		c.setRequestHeader = b
+	}
+}
+
+// WithIncomingHeaders optional the ordered list of the incoming header names,
+// the first non-empty one is used, like "X-Request-ID", "X-Correlation-ID",
+// or the gRPC gateway metadata "Grpc-Metadata-X-Request-Id".
+// (default the request id header)
+func WithIncomingHeaders(headers ...string) Option {
+	return func(c *Config) {
+		c.incomingHeaders = headers
+	}
+}
+
+// WithResponseHeaders optional the response header names which the request id is echoed to.
+// (default the request id header)
+func WithResponseHeaders(headers ...string) Option {
+	return func(c *Config) {
+		c.responseHeaders = headers
+	}
+}
+
 // RequestID is a middleware that injects a request ID into the context of each
-// request. if it is empty, set the write head
+// request, and echoes it in the response header, see WithEcho.
 // - requestIDHeader is the name of the HTTP Header which contains the request id.
 // Exported so that it can be changed by developers. (default "X-Request-Id")
 // - nextRequestID generates the next request ID.(default NextRequestID)
+// The incoming request id is validated to avoid log injection,
+// see WithMaxLength, WithAllowedPattern and WithInvalidPolicy.
 func RequestID(opts ...Option) func(next http.Handler) http.Handler {
 	c := &Config{
 		requestIDHeader: "X-Request-ID",
 		nextRequestID:   NextRequestID,
+		maxLength:       128,
+		invalidPrefix:   "untrusted-",
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	if len(c.incomingHeaders) == 0 {
+		c.incomingHeaders = []string{c.requestIDHeader}
+	}
+	if len(c.responseHeaders) == 0 {
+		c.responseHeaders = []string{c.requestIDHeader}
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
-			requestID := r.Header.Get(c.requestIDHeader)
-			if requestID == "" {
+			var requestID, source string
+			if c.isTrusted(r) {
+				for _, header := range c.incomingHeaders {
+					if requestID = r.Header.Get(header); requestID != "" {
+						source = header
+						break
+					}
+				}
+			}
+			if requestID != "" && !c.isValid(requestID) {
+				switch c.invalidPolicy {
+				case InvalidReject:
+					http.Error(w, "invalid request id", http.StatusBadRequest)
+					return
+				case InvalidPrefix:
+					requestID = c.sanitize(requestID)
+				default:
+					requestID = ""
+				}
+			}
+			generated := requestID == ""
+			if generated {
 				requestID = c.nextRequestID()
-				w.Header().Add(c.requestIDHeader, requestID)
+				source = ""
+			}
+			if c.echo == EchoAlways || (c.echo == EchoGenerated && generated) {
+				for _, header := range c.responseHeaders {
+					w.Header().Set(header, requestID)
+				}
 			}
-			ctx = context.WithValue(ctx, ctxRequestIDKey{}, requestID)
+			if c.setRequestHeader && r.Header.Get(c.requestIDHeader) != requestID {
+				r.Header.Set(c.requestIDHeader, requestID)
+			}
+			ctx = context.WithValue(ctx, ctxRequestIDKey{}, requestIDValue{requestID, source})
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// isTrusted reports whether the incoming request id of the request can be trusted.
+func (c *Config) isTrusted(r *http.Request) bool {
+	if c.trustedProxies == nil {
+		return true
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	return err == nil && c.trustedProxies.IsTrusted(ip)
+}
+
+// isValid reports whether the request id is valid.
+func (c *Config) isValid(id string) bool {
+	if c.maxLength > 0 && len(id) > c.maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !isVisibleASCII(id[i]) {
+			return false
+		}
+	}
+	return c.pattern == nil || c.pattern.MatchString(id)
+}
+
+// sanitize returns the prefixed request id with the disallowed characters removed,
+// the sanitized part is truncated so the whole id fits the max length.
+// It returns empty string if nothing is left or no room is left after the prefix.
+func (c *Config) sanitize(id string) string {
+	limit := -1
+	if c.maxLength > 0 {
+		if limit = c.maxLength - len(c.invalidPrefix); limit <= 0 {
+			return ""
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(id) && b.Len() != limit; i++ {
+		ch := id[i]
+		if !isVisibleASCII(ch) || (c.sanitizeChars != "" && strings.IndexByte(c.sanitizeChars, ch) < 0) {
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return c.invalidPrefix + b.String()
+}
+
+func isVisibleASCII(c byte) bool { return c > 0x20 && c < 0x7f }
+
 // FromRequestID returns a request ID from the given context if one is present.
 // Returns the empty string if a request ID cannot be found.
 func FromRequestID(ctx context.Context) string {
-	reqID, ok := ctx.Value(ctxRequestIDKey{}).(string)
+	v, ok := ctx.Value(ctxRequestIDKey{}).(requestIDValue)
 	if !ok {
 		return ""
 	}
-	return reqID
+	return v.id
+}
+
+// FromRequestIDHeader returns the incoming header name which the request ID came from.
+// Returns the empty string if the request ID is generated or cannot be found.
+func FromRequestIDHeader(ctx context.Context) string {
+	v, _ := ctx.Value(ctxRequestIDKey{}).(requestIDValue)
+	return v.header
+}
+
+// FromRequest returns a request ID from the given request context if one is present,
+// otherwise from the first non-empty request header of headers, see WithSetRequestHeader.
+// headers should be the header configured by WithRequestIDHeader, empty means the default "X-Request-ID".
+// Returns the empty string if a request ID cannot be found.
+func FromRequest(r *http.Request, headers ...string) string {
+	if reqID := FromRequestID(r.Context()); reqID != "" {
+		return reqID
+	}
+	if len(headers) == 0 {
+		return r.Header.Get("X-Request-ID")
+	}
+	for _, header := range headers {
+		if reqID := r.Header.Get(header); reqID != "" {
+			return reqID
+		}
+	}
+	return ""
+}
+
+// Generator generates the request ID of the form like {prefix}{sequence},
+// each generator has its own prefix and sequence state.
+type Generator struct {
+	prefix     string
+	sequenceID uint64
+}
+
+// GeneratorOption generator option
+type GeneratorOption func(*generatorConfig)
+
+type generatorConfig struct {
+	prefix   *string
+	omitHost bool
+	seed     *int64
+}
+
+// WithGeneratorPrefix optional the fixed prefix of the generator,
+// which replaces the {hostname}-{pid}-{rand-value}- prefix.
+func WithGeneratorPrefix(prefix string) GeneratorOption {
+	return func(c *generatorConfig) {
+		c.prefix = &prefix
+	}
+}
+
+// WithoutHost optional omit the hostname and pid in the prefix,
+// the prefix is {rand-value}-.
+func WithoutHost() GeneratorOption {
+	return func(c *generatorConfig) {
+		c.omitHost = true
+	}
 }
 
-var prefix string
-var sequenceID uint64
+// WithSeed optional the seed of the random prefix, the generator is deterministic,
+// which is useful in tests. It implies WithoutHost, so the same seed generates
+// the same ids across hosts and runs.
+func WithSeed(seed int64) GeneratorOption {
+	return func(c *generatorConfig) {
+		c.seed = &seed
+		c.omitHost = true
+	}
+}
 
+// NewGenerator new a request ID generator, the prefix is {hostname}-{pid}-{rand-value}-
+// by default, where "rand-value" is a base62 random string that uniquely identifies the generator.
+//
 // see chi middleware request_id
 // A quick note on the statistics here: we're trying to calculate the chance that
 // two randomly generated base62 prefixes will collide. We use the formula from
@@ -99,28 +391,57 @@ var sequenceID uint64
 // our purposes, and is surely more than anyone would ever need in practice -- a
 // process that is rebooted a handful of times a day for a hundred years has less
 // than a millionth of a percent chance of generating two colliding IDs.
+func NewGenerator(opts ...GeneratorOption) *Generator {
+	c := &generatorConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.prefix != nil {
+		return &Generator{prefix: *c.prefix}
+	}
 
-func init() {
-	hostname, err := os.Hostname()
-	if hostname == "" || err != nil {
-		hostname = "localhost"
+	read := rand.Read
+	if c.seed != nil {
+		read = mrand.New(mrand.NewSource(*c.seed)).Read // nolint: gosec
 	}
 	var buf [20]byte
 	var b64 string
 	for len(b64) < 16 {
-		_, _ = rand.Read(buf[:])
+		_, _ = read(buf[:])
 		b64 = base64.StdEncoding.EncodeToString(buf[:])
 		b64 = strings.NewReplacer("+", "", "/", "").Replace(b64)
 	}
+	if c.omitHost {
+		return &Generator{prefix: b64[:16] + "-"}
+	}
+	hostname, err := os.Hostname()
+	if hostname == "" || err != nil {
+		hostname = "localhost"
+	}
+	return &Generator{prefix: fmt.Sprintf("%s-%d-%s-", hostname, os.Getpid(), b64[:16])}
+}
+
+// Prefix returns the prefix of the generator.
+func (g *Generator) Prefix() string { return g.prefix }
 
-	prefix = fmt.Sprintf("%s-%d-%s-", hostname, os.Getpid(), b64[:16])
+// Next generates the next request ID, it is safe for concurrent use.
+func (g *Generator) Next() string {
+	return fmt.Sprintf("%s%012d", g.prefix, atomic.AddUint64(&g.sequenceID, 1))
 }
 
-// NextRequestID generates the next request ID.
+// Reset resets the sequence of the generator to zero.
+func (g *Generator) Reset() {
+	atomic.StoreUint64(&g.sequenceID, 0)
+}
+
+// defaultGenerator the generator of NextRequestID.
+var defaultGenerator = NewGenerator()
+
+// NextRequestID generates the next request ID with the default generator.
 // A request ID is a string of the form like {hostname}-{pid}-{init-rand-value}-{sequence},
 // where "random" is a base62 random string that uniquely identifies this go
 // process, and where the last number is an atomically incremented request
-// counter.
+// counter. Use NewGenerator for the ID without host information or the deterministic ID.
 func NextRequestID() string {
-	return fmt.Sprintf("%s%012d", prefix, atomic.AddUint64(&sequenceID, 1))
+	return defaultGenerator.Next()
 }
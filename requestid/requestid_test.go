@@ -5,9 +5,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/thinkgos/http-middlewares/mids"
 )
 
 func TestRequestID(t *testing.T) {
@@ -65,3 +72,357 @@ func BenchmarkNextRequestID(b *testing.B) {
 		NextRequestID()
 	}
 }
+
+func TestRequestIDValidation(t *testing.T) {
+	longID := strings.Repeat("a", 129)
+	tests := map[string]struct {
+		opts         []Option
+		requestID    string
+		expectedCode int
+		expectedID   string // empty means a new generated id
+	}{
+		"Valid id": {
+			nil, "req-123456", http.StatusOK, "req-123456",
+		},
+		"Too long id is replaced": {
+			nil, longID, http.StatusOK, "",
+		},
+		"Control characters are replaced": {
+			nil, "req\r\nfake log line", http.StatusOK, "",
+		},
+		"Custom max length": {
+			[]Option{WithMaxLength(200)}, longID, http.StatusOK, longID,
+		},
+		"Disallowed by pattern": {
+			[]Option{WithAllowedPattern(regexp.MustCompile(`^[a-z0-9-]+$`))}, "req:123", http.StatusOK, "",
+		},
+		"Rejected": {
+			[]Option{WithInvalidPolicy(InvalidReject)}, "req 123", http.StatusBadRequest, "",
+		},
+		"Prefixed and kept": {
+			[]Option{WithInvalidPolicy(InvalidPrefix)}, "req 123\n", http.StatusOK, "untrusted-req123",
+		},
+		"Control characters with permissive pattern": {
+			[]Option{WithAllowedPattern(regexp.MustCompile(`^.+$`))}, "req\x1b[31m", http.StatusOK, "",
+		},
+		"Structural pattern": {
+			[]Option{WithAllowedPattern(regexp.MustCompile(`^req-[0-9]+$`))}, "req-123", http.StatusOK, "req-123",
+		},
+		"Prefixed with sanitize chars and max length": {
+			[]Option{
+				WithInvalidPolicy(InvalidPrefix),
+				WithInvalidPrefix("x-"),
+				WithMaxLength(8),
+				WithSanitizeChars("abcdefghijklmnopqrstuvwxyz0123456789"),
+			},
+			"ab:cd:ef:gh", http.StatusOK, "x-abcdef",
+		},
+		"Prefixed with structural pattern": {
+			[]Option{
+				WithInvalidPolicy(InvalidPrefix),
+				WithAllowedPattern(regexp.MustCompile(`^[a-z0-9]{8,}$`)),
+			},
+			"abc\n123", http.StatusOK, "untrusted-abc123",
+		},
+		"Prefixed with pattern and sanitize chars": {
+			[]Option{
+				WithInvalidPolicy(InvalidPrefix),
+				WithAllowedPattern(regexp.MustCompile(`^req-[0-9]+$`)),
+				WithSanitizeChars("req-0123456789"),
+			},
+			"req-12 34;drop", http.StatusOK, "untrusted-req-1234r",
+		},
+		"Prefixed and truncated after the prefix": {
+			[]Option{WithInvalidPolicy(InvalidPrefix), WithInvalidPrefix("u-"), WithMaxLength(8)},
+			"abc def ghi", http.StatusOK, "u-abcdef",
+		},
+		"Prefix leaves no room": {
+			[]Option{WithInvalidPolicy(InvalidPrefix), WithMaxLength(8)},
+			"abc def ghi", http.StatusOK, "",
+		},
+		"Prefixed but nothing left": {
+			[]Option{WithInvalidPolicy(InvalidPrefix)}, "\t\t", http.StatusOK, "",
+		},
+	}
+
+	for name, test := range tests {
+		var requestID string
+		h := RequestID(append(test.opts, WithNextRequestID(func() string { return "generated" }))...)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestID = FromRequestID(r.Context())
+			}))
+		req, _ := http.NewRequestWithContext(context.TODO(), "GET", "/", nil)
+		req.Header.Set("X-Request-Id", test.requestID)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.expectedCode {
+			t.Errorf("%s: status = %d, want %d", name, w.Code, test.expectedCode)
+			continue
+		}
+		if test.expectedCode != http.StatusOK {
+			continue
+		}
+		expectedID := test.expectedID
+		if expectedID == "" {
+			expectedID = "generated"
+		}
+		if requestID != expectedID {
+			t.Errorf("%s: request id = %q, want %q", name, requestID, expectedID)
+		}
+	}
+}
+
+func TestRequestIDEchoAndTrust(t *testing.T) {
+	proxies, err := mids.NewTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		opts         []Option
+		remoteAddr   string
+		requestID    string
+		expectedID   string
+		expectedEcho string
+	}{
+		"Echo supplied id by default": {
+			nil, "1.2.3.4:1234", "req-1", "req-1", "req-1",
+		},
+		"Echo generated id by default": {
+			nil, "1.2.3.4:1234", "", "generated", "generated",
+		},
+		"Echo only generated": {
+			[]Option{WithEcho(EchoGenerated)}, "1.2.3.4:1234", "req-1", "req-1", "",
+		},
+		"Never echo": {
+			[]Option{WithEcho(EchoNever)}, "1.2.3.4:1234", "", "generated", "",
+		},
+		"Trusted proxy": {
+			[]Option{WithTrustedProxies(proxies)}, "10.0.0.1:1234", "req-1", "req-1", "req-1",
+		},
+		"Untrusted client": {
+			[]Option{WithTrustedProxies(proxies)}, "1.2.3.4:1234", "req-1", "generated", "generated",
+		},
+	}
+
+	for name, test := range tests {
+		var requestID string
+		h := RequestID(append(test.opts, WithNextRequestID(func() string { return "generated" }))...)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestID = FromRequestID(r.Context())
+			}))
+		req, _ := http.NewRequestWithContext(context.TODO(), "GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.requestID != "" {
+			req.Header.Set("X-Request-Id", test.requestID)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if requestID != test.expectedID {
+			t.Errorf("%s: request id = %q, want %q", name, requestID, test.expectedID)
+		}
+		if echo := w.Header().Get("X-Request-Id"); echo != test.expectedEcho {
+			t.Errorf("%s: echo = %q, want %q", name, echo, test.expectedEcho)
+		}
+	}
+}
+
+func TestRequestIDSetRequestHeader(t *testing.T) {
+	var upstream string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Get("X-Request-Id")
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	var fromRequest string
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	h := RequestID(WithSetRequestHeader(true), WithNextRequestID(func() string { return "generated" }))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fromRequest = FromRequest(r)
+			proxy.ServeHTTP(w, r)
+		}))
+	req, _ := http.NewRequestWithContext(context.TODO(), "GET", "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if fromRequest != "generated" || upstream != "generated" {
+		t.Errorf("FromRequest() = %q, upstream = %q, want generated", fromRequest, upstream)
+	}
+
+	// without the middleware, fallback to the header.
+	req.Header.Set("X-Request-Id", "req-1")
+	if got := FromRequest(req); got != "req-1" {
+		t.Errorf("FromRequest() = %q, want req-1", got)
+	}
+}
+
+func TestFromRequestHeader(t *testing.T) {
+	var inHandler string
+	var forwarded *http.Request
+	h := RequestID(
+		WithRequestIDHeader("X-Trace-Id"),
+		WithSetRequestHeader(true),
+		WithNextRequestID(func() string { return "generated" }),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inHandler = FromRequest(r, "X-Trace-Id")
+		// like a proxied request, the context is not carried.
+		forwarded = r.WithContext(context.Background())
+	}))
+	req, _ := http.NewRequestWithContext(context.TODO(), "GET", "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	tests := map[string]struct {
+		headers  []string
+		expected string
+	}{
+		"Configured header": {[]string{"X-Trace-Id"}, "generated"},
+		"Ordered headers":   {[]string{"X-Correlation-Id", "X-Trace-Id"}, "generated"},
+		"Default header":    {nil, ""},
+		"Unknown header":    {[]string{"X-Correlation-Id"}, ""},
+	}
+	if inHandler != "generated" {
+		t.Errorf("FromRequest() in handler = %q, want generated", inHandler)
+	}
+	for name, test := range tests {
+		if got := FromRequest(forwarded, test.headers...); got != test.expected {
+			t.Errorf("%s: FromRequest() = %q, want %q", name, got, test.expected)
+		}
+	}
+}
+
+func TestRequestIDMultipleHeaders(t *testing.T) {
+	opts := []Option{
+		WithIncomingHeaders("X-Request-Id", "X-Correlation-Id", "Request-Id"),
+		WithResponseHeaders("X-Request-Id", "Request-Id"),
+		WithNextRequestID(func() string { return "generated" }),
+	}
+	tests := map[string]struct {
+		header         http.Header
+		expectedID     string
+		expectedSource string
+	}{
+		"First header": {
+			http.Header{"X-Request-Id": {"req-1"}, "Request-Id": {"req-3"}}, "req-1", "X-Request-Id",
+		},
+		"Fallback header": {
+			http.Header{"X-Correlation-Id": {"req-2"}, "Request-Id": {"req-3"}}, "req-2", "X-Correlation-Id",
+		},
+		"Last header": {
+			http.Header{"Request-Id": {"req-3"}}, "req-3", "Request-Id",
+		},
+		"Generated": {
+			http.Header{}, "generated", "",
+		},
+		"Unknown header": {
+			http.Header{"Trace-Id": {"req-4"}}, "generated", "",
+		},
+	}
+
+	for name, test := range tests {
+		var requestID, source string
+		h := RequestID(opts...)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestID = FromRequestID(r.Context())
+				source = FromRequestIDHeader(r.Context())
+			}))
+		req, _ := http.NewRequestWithContext(context.TODO(), "GET", "/", nil)
+		req.Header = test.header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if requestID != test.expectedID {
+			t.Errorf("%s: request id = %q, want %q", name, requestID, test.expectedID)
+		}
+		if source != test.expectedSource {
+			t.Errorf("%s: source = %q, want %q", name, source, test.expectedSource)
+		}
+		for _, header := range []string{"X-Request-Id", "Request-Id"} {
+			if echo := w.Header().Get(header); echo != test.expectedID {
+				t.Errorf("%s: %s echo = %q, want %q", name, header, echo, test.expectedID)
+			}
+		}
+		if echo := w.Header().Get("X-Correlation-Id"); echo != "" {
+			t.Errorf("%s: unexpected X-Correlation-Id echo %q", name, echo)
+		}
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	hostname, _ := os.Hostname()
+	tests := map[string]struct {
+		opts          []GeneratorOption
+		deterministic bool
+		hasHost       bool
+	}{
+		"Default":       {nil, false, true},
+		"Without host":  {[]GeneratorOption{WithoutHost()}, false, false},
+		"Seeded":        {[]GeneratorOption{WithSeed(1)}, true, false},
+		"Deterministic": {[]GeneratorOption{WithoutHost(), WithSeed(1)}, true, false},
+		"Fixed prefix":  {[]GeneratorOption{WithGeneratorPrefix("test-")}, true, false},
+	}
+
+	for name, test := range tests {
+		g1, g2 := NewGenerator(test.opts...), NewGenerator(test.opts...)
+		if got := g1.Prefix() == g2.Prefix(); got != test.deterministic {
+			t.Errorf("%s: prefix %q and %q equal = %v, want %v", name, g1.Prefix(), g2.Prefix(), got, test.deterministic)
+		}
+		if got := hostname != "" && strings.HasPrefix(g1.Prefix(), hostname+"-"); got != test.hasHost {
+			t.Errorf("%s: prefix %q has host = %v, want %v", name, g1.Prefix(), got, test.hasHost)
+		}
+	}
+
+	seeds := map[int64]string{
+		1:  "Uv38ByGCZU8WP18P-",
+		42: "U4xlrFkvxuXu59Lt-",
+	}
+	for seed, want := range seeds {
+		g := NewGenerator(WithSeed(seed))
+		if got := g.Prefix(); got != want {
+			t.Errorf("seed %d: prefix = %q, want %q", seed, got, want)
+		}
+		if got := g.Next(); got != want+"000000000001" {
+			t.Errorf("seed %d: Next() = %q, want %q", seed, got, want+"000000000001")
+		}
+	}
+
+	g := NewGenerator(WithGeneratorPrefix("test-"))
+	for _, want := range []string{"test-000000000001", "test-000000000002"} {
+		if got := g.Next(); got != want {
+			t.Errorf("Next() = %q, want %q", got, want)
+		}
+	}
+	g.Reset()
+	if got, want := g.Next(), "test-000000000001"; got != want {
+		t.Errorf("Next() after Reset = %q, want %q", got, want)
+	}
+}
+
+func TestRenderJSONError(t *testing.T) {
+	tests := map[string]struct {
+		requestID string
+		expected  string
+	}{
+		"With request id":    {"req-1", `{"code":429,"message":"limit","request_id":"req-1"}`},
+		"Without request id": {"", `{"code":429,"message":"limit"}`},
+	}
+
+	for name, test := range tests {
+		req, _ := http.NewRequestWithContext(context.TODO(), "GET", "/", nil)
+		if test.requestID != "" {
+			req = req.WithContext(context.WithValue(req.Context(), ctxRequestIDKey{}, requestIDValue{id: test.requestID}))
+		}
+		w := httptest.NewRecorder()
+		RenderJSONError(w, req, http.StatusTooManyRequests, "limit")
+
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("%s: code = %d, want %d", name, w.Code, http.StatusTooManyRequests)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("%s: content type = %q", name, ct)
+		}
+		if body := w.Body.String(); body != test.expected {
+			t.Errorf("%s: body = %s, want %s", name, body, test.expected)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package traceid
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// B3 and Jaeger header names.
+const (
+	B3Header             = "b3"
+	B3TraceIDHeader      = "X-B3-TraceId"
+	B3SpanIDHeader       = "X-B3-SpanId"
+	B3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+	B3FlagsHeader        = "X-B3-Flags"
+	JaegerHeader         = "uber-trace-id"
+)
+
+// Propagator extracts and injects the trace context from and to the http headers.
+type Propagator interface {
+	// Extract extracts the trace context from the headers, it reports whether
+	// a valid trace context is found. The SpanID of the returned trace context
+	// is the span id of the caller.
+	Extract(h http.Header) (TraceContext, bool)
+	// Inject injects the trace context into the headers.
+	Inject(h http.Header, tc TraceContext)
+}
+
+// Built-in propagators.
+var (
+	// W3C the W3C Trace Context traceparent and tracestate headers.
+	W3C Propagator = w3cPropagator{}
+	// B3Single the Zipkin B3 single header "b3".
+	B3Single Propagator = b3SinglePropagator{}
+	// B3Multi the Zipkin B3 multiple "X-B3-*" headers.
+	B3Multi Propagator = b3MultiPropagator{}
+	// Jaeger the Jaeger "uber-trace-id" header.
+	Jaeger Propagator = jaegerPropagator{}
+)
+
+type w3cPropagator struct{}
+
+func (w3cPropagator) Extract(h http.Header) (TraceContext, bool) {
+	tc, ok := ParseTraceParent(h.Get(TraceParentHeader))
+	if ok {
+		tc.TraceState = ParseTraceState(h.Values(TraceStateHeader))
+	}
+	return tc, ok
+}
+
+func (w3cPropagator) Inject(h http.Header, tc TraceContext) {
+	h.Set(TraceParentHeader, tc.TraceParent())
+	if tc.TraceState != "" {
+		h.Set(TraceStateHeader, tc.TraceState)
+	}
+}
+
+type b3SinglePropagator struct{}
+
+// Extract parses b3: {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId},
+// the SamplingState and ParentSpanId are optional.
+func (b3SinglePropagator) Extract(h http.Header) (TraceContext, bool) {
+	var tc TraceContext
+	parts := strings.Split(h.Get(B3Header), "-")
+	// only sampling state, like "b3: 0", no trace context.
+	if len(parts) < 2 || len(parts) > 4 {
+		return tc, false
+	}
+	if !parseB3TraceID(&tc.TraceID, parts[0]) || !parseB3SpanID(&tc.SpanID, parts[1]) {
+		return tc, false
+	}
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1", "d":
+			tc.Flags = FlagsSampled
+		case "0":
+		default:
+			return tc, false
+		}
+	}
+	if len(parts) > 3 && !parseB3SpanID(&tc.ParentSpanID, parts[3]) {
+		return tc, false
+	}
+	return tc, tc.TraceID.IsValid() && tc.SpanID.IsValid()
+}
+
+func (b3SinglePropagator) Inject(h http.Header, tc TraceContext) {
+	v := tc.TraceID.String() + "-" + tc.SpanID.String() + "-" + sampledString(tc)
+	if tc.ParentSpanID.IsValid() {
+		v += "-" + tc.ParentSpanID.String()
+	}
+	h.Set(B3Header, v)
+}
+
+type b3MultiPropagator struct{}
+
+func (b3MultiPropagator) Extract(h http.Header) (TraceContext, bool) {
+	var tc TraceContext
+	if !parseB3TraceID(&tc.TraceID, h.Get(B3TraceIDHeader)) ||
+		!parseB3SpanID(&tc.SpanID, h.Get(B3SpanIDHeader)) {
+		return tc, false
+	}
+	if v := h.Get(B3ParentSpanIDHeader); v != "" && !parseB3SpanID(&tc.ParentSpanID, v) {
+		return tc, false
+	}
+	switch strings.ToLower(h.Get(B3SampledHeader)) {
+	case "1", "true":
+		tc.Flags = FlagsSampled
+	case "", "0", "false":
+	default:
+		return tc, false
+	}
+	// debug implies sampled.
+	if h.Get(B3FlagsHeader) == "1" {
+		tc.Flags = FlagsSampled
+	}
+	return tc, tc.TraceID.IsValid() && tc.SpanID.IsValid()
+}
+
+func (b3MultiPropagator) Inject(h http.Header, tc TraceContext) {
+	h.Set(B3TraceIDHeader, tc.TraceID.String())
+	h.Set(B3SpanIDHeader, tc.SpanID.String())
+	if tc.ParentSpanID.IsValid() {
+		h.Set(B3ParentSpanIDHeader, tc.ParentSpanID.String())
+	}
+	h.Set(B3SampledHeader, sampledString(tc))
+}
+
+type jaegerPropagator struct{}
+
+// Extract parses uber-trace-id: {trace-id}:{span-id}:{parent-span-id}:{flags},
+// the parent-span-id is deprecated and may be 0.
+func (jaegerPropagator) Extract(h http.Header) (TraceContext, bool) {
+	var tc TraceContext
+	// some clients url-encode the header value.
+	v := strings.ReplaceAll(h.Get(JaegerHeader), "%3A", ":")
+	parts := strings.Split(v, ":")
+	if len(parts) != 4 {
+		return tc, false
+	}
+	if !parseHexID(tc.TraceID[:], parts[0]) || !parseHexID(tc.SpanID[:], parts[1]) {
+		return tc, false
+	}
+	if parts[2] != "0" && !parseHexID(tc.ParentSpanID[:], parts[2]) {
+		return tc, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return tc, false
+	}
+	// 0x01 sampled, 0x02 debug which implies sampled.
+	if flags&0x03 != 0 {
+		tc.Flags = FlagsSampled
+	}
+	return tc, tc.TraceID.IsValid() && tc.SpanID.IsValid()
+}
+
+func (jaegerPropagator) Inject(h http.Header, tc TraceContext) {
+	parent := "0"
+	if tc.ParentSpanID.IsValid() {
+		parent = tc.ParentSpanID.String()
+	}
+	h.Set(JaegerHeader, tc.TraceID.String()+":"+tc.SpanID.String()+":"+parent+":"+sampledString(tc))
+}
+
+// parseHexID parses the hex id s into dst, the short id is left-padded with zero, like Jaeger.
+func parseHexID(dst []byte, s string) bool {
+	n := len(dst) * 2
+	if s == "" || len(s) > n {
+		return false
+	}
+	padded := strings.Repeat("0", n-len(s)) + strings.ToLower(s)
+	_, err := hex.Decode(dst, []byte(padded))
+	return err == nil
+}
+
+// parseB3TraceID parses the B3 trace id, which is 16 or 32 hex characters.
+func parseB3TraceID(dst *ID, s string) bool {
+	return (len(s) == 16 || len(s) == 32) && parseHexID(dst[:], s)
+}
+
+// parseB3SpanID parses the B3 span id, which is 16 hex characters.
+func parseB3SpanID(dst *SpanID, s string) bool {
+	return len(s) == 16 && parseHexID(dst[:], s)
+}
+
+func sampledString(tc TraceContext) string {
+	if tc.Sampled() {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,142 @@
+package traceid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPropagatorExtract(t *testing.T) {
+	tests := map[string]struct {
+		propagator  Propagator
+		headers     map[string]string
+		valid       bool
+		wantTraceID string
+		wantSpanID  string
+		wantSampled bool
+	}{
+		"b3 single": {
+			B3Single,
+			map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"},
+			true, "80f198ee56343ba864fe8b2a57d3eff7", "e457b5a2e4d86bd1", true,
+		},
+		"b3 single 64bit trace id": {
+			B3Single,
+			map[string]string{"b3": "64fe8b2a57d3eff7-e457b5a2e4d86bd1-0"},
+			true, "000000000000000064fe8b2a57d3eff7", "e457b5a2e4d86bd1", false,
+		},
+		"b3 single debug": {
+			B3Single,
+			map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d"},
+			true, "80f198ee56343ba864fe8b2a57d3eff7", "e457b5a2e4d86bd1", true,
+		},
+		"b3 single sampling only": {
+			B3Single, map[string]string{"b3": "0"}, false, "", "", false,
+		},
+		"b3 single invalid sampling": {
+			B3Single,
+			map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-x"},
+			false, "", "", false,
+		},
+		"b3 multi": {
+			B3Multi,
+			map[string]string{
+				"X-B3-TraceId":      "80f198ee56343ba864fe8b2a57d3eff7",
+				"X-B3-SpanId":       "e457b5a2e4d86bd1",
+				"X-B3-ParentSpanId": "05e3ac9a4f6e3b90",
+				"X-B3-Sampled":      "1",
+			},
+			true, "80f198ee56343ba864fe8b2a57d3eff7", "e457b5a2e4d86bd1", true,
+		},
+		"b3 multi debug flag": {
+			B3Multi,
+			map[string]string{
+				"X-B3-TraceId": "64fe8b2a57d3eff7",
+				"X-B3-SpanId":  "e457b5a2e4d86bd1",
+				"X-B3-Flags":   "1",
+			},
+			true, "000000000000000064fe8b2a57d3eff7", "e457b5a2e4d86bd1", true,
+		},
+		"b3 multi missing span id": {
+			B3Multi, map[string]string{"X-B3-TraceId": "64fe8b2a57d3eff7"}, false, "", "", false,
+		},
+		"jaeger": {
+			Jaeger,
+			map[string]string{"uber-trace-id": "80f198ee56343ba864fe8b2a57d3eff7:e457b5a2e4d86bd1:0:1"},
+			true, "80f198ee56343ba864fe8b2a57d3eff7", "e457b5a2e4d86bd1", true,
+		},
+		"jaeger short ids and url encoded": {
+			Jaeger,
+			map[string]string{"uber-trace-id": "abc%3Adef%3A0%3A2"},
+			true, "00000000000000000000000000000abc", "0000000000000def", true,
+		},
+		"jaeger not sampled": {
+			Jaeger,
+			map[string]string{"uber-trace-id": "abc:def:123:0"},
+			true, "00000000000000000000000000000abc", "0000000000000def", false,
+		},
+		"jaeger invalid": {
+			Jaeger, map[string]string{"uber-trace-id": "abc:def:0"}, false, "", "", false,
+		},
+		"w3c": {
+			W3C,
+			map[string]string{"traceparent": "00-80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-01"},
+			true, "80f198ee56343ba864fe8b2a57d3eff7", "e457b5a2e4d86bd1", true,
+		},
+	}
+	for name, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.headers {
+			h.Set(k, v)
+		}
+		tc, ok := tt.propagator.Extract(h)
+		if ok != tt.valid {
+			t.Errorf("%s: Extract() valid = %v, want %v", name, ok, tt.valid)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if tc.TraceID.String() != tt.wantTraceID || tc.SpanID.String() != tt.wantSpanID || tc.Sampled() != tt.wantSampled {
+			t.Errorf("%s: Extract() = %s %s %v, want %s %s %v", name,
+				tc.TraceID, tc.SpanID, tc.Sampled(), tt.wantTraceID, tt.wantSpanID, tt.wantSampled)
+		}
+	}
+}
+
+func TestPropagatorRoundTrip(t *testing.T) {
+	tc := TraceContext{TraceID: NewTraceID(), SpanID: NewSpanID(), ParentSpanID: NewSpanID(), Flags: FlagsSampled}
+	for name, p := range map[string]Propagator{"w3c": W3C, "b3 single": B3Single, "b3 multi": B3Multi, "jaeger": Jaeger} {
+		h := http.Header{}
+		p.Inject(h, tc)
+		got, ok := p.Extract(h)
+		if !ok || got.TraceID != tc.TraceID || got.SpanID != tc.SpanID || got.Sampled() != tc.Sampled() {
+			t.Errorf("%s: round trip = %+v, want %+v", name, got, tc)
+		}
+	}
+}
+
+func TestTraceIDPropagators(t *testing.T) {
+	h := TraceID(
+		WithExtractors(W3C, B3Multi, B3Single, Jaeger),
+		WithInjectors(W3C, B3Single),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("uber-trace-id", "80f198ee56343ba864fe8b2a57d3eff7:e457b5a2e4d86bd1:0:1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	for name, p := range map[string]Propagator{"w3c": W3C, "b3 single": B3Single} {
+		tc, ok := p.Extract(w.Header())
+		if !ok || tc.TraceID.String() != "80f198ee56343ba864fe8b2a57d3eff7" || !tc.Sampled() {
+			t.Errorf("%s: response trace context %+v", name, tc)
+		}
+	}
+	if tc, _ := B3Single.Extract(w.Header()); tc.ParentSpanID.String() != "e457b5a2e4d86bd1" {
+		t.Errorf("parent span id = %s, want the caller span id", tc.ParentSpanID)
+	}
+	if w.Header().Get("uber-trace-id") != "" {
+		t.Errorf("jaeger should not be injected")
+	}
+}
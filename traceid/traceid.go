@@ -0,0 +1,338 @@
+package traceid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context header names.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// ID a W3C trace id, 16 bytes.
+type ID [16]byte
+
+// String returns the lowercase hex string of trace id.
+func (t ID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid reports whether the trace id is valid, the all zero trace id is invalid.
+func (t ID) IsValid() bool { return t != ID{} }
+
+// SpanID a W3C span id (parent-id), 8 bytes.
+type SpanID [8]byte
+
+// String returns the lowercase hex string of span id.
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether the span id is valid, the all zero span id is invalid.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// FlagsSampled the sampled trace flag.
+const FlagsSampled byte = 0x01
+
+// TraceContext the W3C trace context of a request.
+type TraceContext struct {
+	// TraceID the trace id
+	TraceID ID
+	// SpanID the span id of the current service
+	SpanID SpanID
+	// ParentSpanID the span id of the caller, invalid if the trace is started by this service
+	ParentSpanID SpanID
+	// Flags the trace flags
+	Flags byte
+	// TraceState the vendor-specific trace state, empty if not present
+	TraceState string
+}
+
+// Sampled reports whether the sampled flag is set.
+func (tc TraceContext) Sampled() bool { return tc.Flags&FlagsSampled != 0 }
+
+// TraceParent returns the traceparent header value with the span id of the current service.
+func (tc TraceContext) TraceParent() string {
+	var b [55]byte
+	b[0], b[1], b[2] = '0', '0', '-'
+	hex.Encode(b[3:35], tc.TraceID[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], tc.SpanID[:])
+	b[52] = '-'
+	hex.Encode(b[53:55], []byte{tc.Flags})
+	return string(b[:])
+}
+
+// Key to use when setting the trace context.
+type ctxTraceKey struct{}
+
+// Config defines the config for TraceID middleware
+type Config struct {
+	traceIDHeader string
+	sampled       bool
+	extractors    []Propagator
+	injectors     []Propagator
+}
+
+// Option TraceID option
+type Option func(*Config)
+
+// WithTraceIDHeader optional the response header which contains the plain trace id,
+// empty means not write. (default "X-Trace-Id")
+func WithTraceIDHeader(s string) Option {
+	return func(c *Config) {
+		c.traceIDHeader = s
+	}
+}
+
+// WithSampled optional the sampled flag of the new trace
+// which is started by this service. (default true)
+func WithSampled(b bool) Option {
+	return func(c *Config) {
+		c.sampled = b
+	}
+}
+
+// WithExtractors optional the propagators which extract the incoming trace context,
+// they are tried in order, the first valid one wins. (default W3C)
+func WithExtractors(ps ...Propagator) Option {
+	return func(c *Config) {
+		c.extractors = ps
+	}
+}
+
+// WithInjectors optional the propagators which inject the trace context
+// into the response headers. (default W3C)
+func WithInjectors(ps ...Propagator) Option {
+	return func(c *Config) {
+		c.injectors = ps
+	}
+}
+
+// TraceID is a middleware that injects a W3C trace context into the context of each request.
+// The incoming trace context is extracted by the extractors, like W3C, B3 or Jaeger,
+// if valid, the trace id is kept and a new span id is generated for the current service,
+// otherwise a new trace is started. The trace context is propagated in the response
+// headers by the injectors, and the trace id in the plain trace id header.
+func TraceID(opts ...Option) func(next http.Handler) http.Handler {
+	c := &Config{
+		traceIDHeader: "X-Trace-Id",
+		sampled:       true,
+		extractors:    []Propagator{W3C},
+		injectors:     []Propagator{W3C},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tc, ok := Extract(r.Header, c.extractors...)
+			if ok {
+				tc.ParentSpanID = tc.SpanID
+			} else {
+				tc = TraceContext{TraceID: NewTraceID()}
+				if c.sampled {
+					tc.Flags = FlagsSampled
+				}
+			}
+			tc.SpanID = NewSpanID()
+
+			h := w.Header()
+			for _, p := range c.injectors {
+				p.Inject(h, tc)
+			}
+			if c.traceIDHeader != "" {
+				h.Set(c.traceIDHeader, tc.TraceID.String())
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithTraceContext(r.Context(), tc)))
+		})
+	}
+}
+
+// Extract extracts the trace context from the headers by the propagators in order,
+// the first valid one wins. It reports whether a valid trace context is found.
+func Extract(h http.Header, ps ...Propagator) (TraceContext, bool) {
+	for _, p := range ps {
+		if tc, ok := p.Extract(h); ok {
+			return tc, true
+		}
+	}
+	return TraceContext{}, false
+}
+
+// ContextWithTraceContext returns a copy of parent in which the trace context is tc.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, ctxTraceKey{}, tc)
+}
+
+// FromTraceContext returns the trace context from the given context if one is present.
+func FromTraceContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(ctxTraceKey{}).(TraceContext)
+	return tc, ok
+}
+
+// FromTraceID returns a trace ID from the given context if one is present.
+// Returns the empty string if a trace ID cannot be found.
+func FromTraceID(ctx context.Context) string {
+	tc, ok := FromTraceContext(ctx)
+	if !ok {
+		return ""
+	}
+	return tc.TraceID.String()
+}
+
+// FromSpanID returns the span ID of the current service from the given context if one is present.
+// Returns the empty string if a span ID cannot be found.
+func FromSpanID(ctx context.Context) string {
+	tc, ok := FromTraceContext(ctx)
+	if !ok {
+		return ""
+	}
+	return tc.SpanID.String()
+}
+
+// NewTraceID generates a new random trace id.
+func NewTraceID() ID {
+	var t ID
+	for !t.IsValid() {
+		_, _ = rand.Read(t[:])
+	}
+	return t
+}
+
+// NewSpanID generates a new random span id.
+func NewSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		_, _ = rand.Read(s[:])
+	}
+	return s
+}
+
+// ParseTraceParent parses the W3C traceparent header value, like:
+//
+//	00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+//
+// it reports whether the value is valid.
+func ParseTraceParent(s string) (TraceContext, bool) {
+	var tc TraceContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return tc, false
+	}
+	var version [1]byte
+	if !decodeLowerHex(version[:], s[0:2]) || version[0] == 0xff {
+		return tc, false
+	}
+	// version 00 must be exact, the future versions may append fields.
+	if (version[0] == 0 && len(s) != 55) || (len(s) > 55 && s[55] != '-') {
+		return tc, false
+	}
+	var flags [1]byte
+	if !decodeLowerHex(tc.TraceID[:], s[3:35]) ||
+		!decodeLowerHex(tc.SpanID[:], s[36:52]) ||
+		!decodeLowerHex(flags[:], s[53:55]) {
+		return tc, false
+	}
+	if !tc.TraceID.IsValid() || !tc.SpanID.IsValid() {
+		return tc, false
+	}
+	tc.Flags = flags[0]
+	if version[0] == 0 {
+		// only the sampled flag is defined in version 00.
+		tc.Flags &= FlagsSampled
+	}
+	return tc, true
+}
+
+// decodeLowerHex decodes the lowercase hex string s to dst.
+func decodeLowerHex(dst []byte, s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// maxTraceStateMembers the max list members of tracestate.
+const maxTraceStateMembers = 32
+
+// ParseTraceState parses and validates the W3C tracestate header values,
+// multiple header values are combined. It returns the normalized tracestate,
+// or empty string if invalid, as the spec requires discarding the invalid tracestate.
+func ParseTraceState(values []string) string {
+	var members []string
+	seen := make(map[string]struct{})
+	for _, v := range values {
+		for _, member := range strings.Split(v, ",") {
+			member = strings.Trim(member, " \t")
+			if member == "" {
+				continue
+			}
+			i := strings.IndexByte(member, '=')
+			if i <= 0 || !isValidTraceStateKey(member[:i]) || !isValidTraceStateValue(member[i+1:]) {
+				return ""
+			}
+			if _, ok := seen[member[:i]]; ok {
+				return ""
+			}
+			seen[member[:i]] = struct{}{}
+			members = append(members, member)
+		}
+	}
+	if len(members) > maxTraceStateMembers {
+		return ""
+	}
+	return strings.Join(members, ",")
+}
+
+// isValidTraceStateKey the key is simple-key or multi-tenant-key:
+//
+//	simple-key = lcalpha 0*255( lcalpha / DIGIT / "_" / "-"/ "*" / "/" )
+//	multi-tenant-key = tenant-id "@" system-id
+//	tenant-id = ( lcalpha / DIGIT ) 0*240( lcalpha / DIGIT / "_" / "-"/ "*" / "/" )
+//	system-id = lcalpha 0*13( lcalpha / DIGIT / "_" / "-"/ "*" / "/" )
+func isValidTraceStateKey(key string) bool {
+	isKeyChar := func(c byte) bool {
+		return 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '_' || c == '-' || c == '*' || c == '/'
+	}
+	check := func(s string, maxLen int, digitFirst bool) bool {
+		if s == "" || len(s) > maxLen {
+			return false
+		}
+		if c := s[0]; !('a' <= c && c <= 'z' || digitFirst && '0' <= c && c <= '9') {
+			return false
+		}
+		for i := 1; i < len(s); i++ {
+			if !isKeyChar(s[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if i := strings.IndexByte(key, '@'); i >= 0 {
+		return check(key[:i], 241, true) && check(key[i+1:], 14, false)
+	}
+	return check(key, 256, false)
+}
+
+// isValidTraceStateValue the value is:
+//
+//	value = 0*255(chr) nblk-chr
+//	nblk-chr = %x21-2B / %x2D-3C / %x3E-7E
+//	chr = %x20 / nblk-chr
+func isValidTraceStateValue(value string) bool {
+	if value == "" || len(value) > 256 || value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
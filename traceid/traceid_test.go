@@ -0,0 +1,141 @@
+package traceid
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := map[string]struct {
+		value string
+		valid bool
+	}{
+		"valid":             {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		"not sampled":       {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		"future version":    {"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		"empty":             {"", false},
+		"invalid version":   {"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		"version 00 longer": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		"uppercase":         {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		"zero trace id":     {"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		"zero span id":      {"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		"bad delimiter":     {"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		"not hex":           {"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01", false},
+	}
+	for name, tt := range tests {
+		tc, ok := ParseTraceParent(tt.value)
+		if ok != tt.valid {
+			t.Errorf("%s: ParseTraceParent() valid = %v, want %v", name, ok, tt.valid)
+			continue
+		}
+		if ok && tc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s: trace id = %s", name, tc.TraceID)
+		}
+	}
+}
+
+func TestParseTraceState(t *testing.T) {
+	tests := map[string]struct {
+		values []string
+		want   string
+	}{
+		"single":         {[]string{"congo=t61rcWkgMzE"}, "congo=t61rcWkgMzE"},
+		"multiple":       {[]string{"rojo=00f067aa0ba902b7, congo=t61rcWkgMzE"}, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"},
+		"multi header":   {[]string{"rojo=1", "congo=2"}, "rojo=1,congo=2"},
+		"multi tenant":   {[]string{"fw529a3039@dt=abc"}, "fw529a3039@dt=abc"},
+		"empty members":  {[]string{"rojo=1,,"}, "rojo=1"},
+		"uppercase key":  {[]string{"Rojo=1"}, ""},
+		"duplicated key": {[]string{"rojo=1,rojo=2"}, ""},
+		"missing value":  {[]string{"rojo="}, ""},
+		"invalid value":  {[]string{"rojo=a=b"}, ""},
+	}
+	for name, tt := range tests {
+		if got := ParseTraceState(tt.values); got != tt.want {
+			t.Errorf("%s: ParseTraceState() = %q, want %q", name, got, tt.want)
+		}
+	}
+
+	var members []string
+	for i := 0; i <= maxTraceStateMembers; i++ {
+		members = append(members, fmt.Sprintf("k%d=v", i))
+	}
+	if got := ParseTraceState([]string{strings.Join(members, ",")}); got != "" {
+		t.Errorf("too many members should be discarded")
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := map[string]struct {
+		request     func() *http.Request
+		wantTraceID string
+		wantState   string
+	}{
+		"Continues the incoming trace": {
+			func() *http.Request {
+				req, _ := http.NewRequestWithContext(context.TODO(), "GET", "/", nil)
+				req.Header.Set("traceparent", traceParent)
+				req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+				return req
+			},
+			"4bf92f3577b34da6a3ce929d0e0e4736",
+			"congo=t61rcWkgMzE",
+		},
+		"Starts a new trace if invalid": {
+			func() *http.Request {
+				req, _ := http.NewRequestWithContext(context.TODO(), "GET", "/", nil)
+				req.Header.Set("traceparent", "invalid")
+				req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+				return req
+			},
+			"",
+			"",
+		},
+	}
+
+	for name, test := range tests {
+		w := httptest.NewRecorder()
+		r := chi.NewRouter()
+		r.Use(TraceID())
+
+		var got TraceContext
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			got, _ = FromTraceContext(r.Context())
+			if FromTraceID(r.Context()) != got.TraceID.String() || FromSpanID(r.Context()) != got.SpanID.String() {
+				t.Errorf("%s: accessor mismatch", name)
+			}
+		})
+		r.ServeHTTP(w, test.request())
+
+		if test.wantTraceID != "" && got.TraceID.String() != test.wantTraceID {
+			t.Errorf("%s: trace id = %s, want %s", name, got.TraceID, test.wantTraceID)
+		}
+		if !got.TraceID.IsValid() || !got.SpanID.IsValid() {
+			t.Errorf("%s: invalid trace context %+v", name, got)
+		}
+		if test.wantTraceID != "" && got.ParentSpanID.String() != "00f067aa0ba902b7" {
+			t.Errorf("%s: parent span id = %s", name, got.ParentSpanID)
+		}
+		if got.TraceState != test.wantState {
+			t.Errorf("%s: trace state = %q, want %q", name, got.TraceState, test.wantState)
+		}
+		if w.Header().Get("traceparent") != got.TraceParent() || w.Header().Get("X-Trace-Id") != got.TraceID.String() {
+			t.Errorf("%s: response headers %v", name, w.Header())
+		}
+		if _, ok := ParseTraceParent(got.TraceParent()); !ok {
+			t.Errorf("%s: invalid traceparent %s", name, got.TraceParent())
+		}
+	}
+}
+
+func BenchmarkNewTraceID(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NewTraceID()
+	}
+}
@@ -0,0 +1,87 @@
+package traceid
+
+import (
+	"net/http"
+
+	"github.com/thinkgos/http-middlewares/requestid"
+)
+
+// TransportConfig defines the config for the outbound Transport
+type TransportConfig struct {
+	injectors       []Propagator
+	requestIDHeader string
+}
+
+// TransportOption NewTransport option
+type TransportOption func(*TransportConfig)
+
+// WithTransportInjectors optional the propagators which inject the trace context
+// into the outgoing request headers. (default W3C)
+func WithTransportInjectors(ps ...Propagator) TransportOption {
+	return func(c *TransportConfig) {
+		c.injectors = ps
+	}
+}
+
+// WithRequestIDHeader optional the request id header which the outbound
+// Transport injects, empty means not inject. (default "X-Request-ID")
+func WithRequestIDHeader(s string) TransportOption {
+	return func(c *TransportConfig) {
+		c.requestIDHeader = s
+	}
+}
+
+// transport propagates the request id and trace context to the downstream services.
+type transport struct {
+	base            http.RoundTripper
+	injectors       []Propagator
+	requestIDHeader string
+}
+
+// NewTransport returns an http.RoundTripper wrapper which reads the request id
+// (set by requestid.RequestID) and the trace context (set by TraceID) from the
+// outgoing request's context, and injects them as headers, so the downstream
+// services see the same correlation ids. A child span id is created for
+// the outgoing request. The headers already set on the request are not overwritten.
+// The trace context is injected by WithTransportInjectors (default W3C).
+// base is used to make the actual request, nil means http.DefaultTransport.
+func NewTransport(base http.RoundTripper, opts ...TransportOption) http.RoundTripper {
+	c := &TransportConfig{
+		injectors:       []Propagator{W3C},
+		requestIDHeader: "X-Request-ID",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base, c.injectors, c.requestIDHeader}
+}
+
+// RoundTrip implement http.RoundTripper interface.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	requestID := requestid.FromRequestID(ctx)
+	tc, hasTrace := FromTraceContext(ctx)
+	if requestID == "" && !hasTrace {
+		return t.base.RoundTrip(req)
+	}
+
+	// a RoundTripper should not modify the request.
+	req = req.Clone(ctx)
+	if requestID != "" && t.requestIDHeader != "" && req.Header.Get(t.requestIDHeader) == "" {
+		req.Header.Set(t.requestIDHeader, requestID)
+	}
+	if hasTrace {
+		child := tc
+		child.ParentSpanID = tc.SpanID
+		child.SpanID = NewSpanID()
+		for _, p := range t.injectors {
+			if _, ok := p.Extract(req.Header); !ok {
+				p.Inject(req.Header, child)
+			}
+		}
+	}
+	return t.base.RoundTrip(req)
+}
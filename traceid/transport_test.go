@@ -0,0 +1,100 @@
+package traceid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/thinkgos/http-middlewares/requestid"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestTransport(t *testing.T) {
+	var got *http.Request
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		got = req
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	tc := TraceContext{TraceID: NewTraceID(), SpanID: NewSpanID(), Flags: FlagsSampled}
+
+	ctx := ContextWithTraceContext(context.Background(), tc)
+	r := requestWithID(ctx, "req-123456")
+	resp, err := NewTransport(base, WithTransportInjectors(W3C, B3Multi)).RoundTrip(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got == r {
+		t.Fatalf("the original request should not be modified")
+	}
+	if len(r.Header) != 0 {
+		t.Errorf("the original request headers modified %v", r.Header)
+	}
+	if got.Header.Get("X-Request-ID") != "req-123456" {
+		t.Errorf("X-Request-ID = %q", got.Header.Get("X-Request-ID"))
+	}
+	for name, p := range map[string]Propagator{"w3c": W3C, "b3 multi": B3Multi} {
+		child, ok := p.Extract(got.Header)
+		if !ok || child.TraceID != tc.TraceID || child.SpanID == tc.SpanID || !child.Sampled() {
+			t.Errorf("%s: child trace context %+v, parent %+v", name, child, tc)
+		}
+	}
+	if got.Header.Get(B3ParentSpanIDHeader) != tc.SpanID.String() {
+		t.Errorf("parent span id = %s, want %s", got.Header.Get(B3ParentSpanIDHeader), tc.SpanID)
+	}
+
+	// without ids, pass through
+	r, _ = http.NewRequestWithContext(context.Background(), http.MethodGet, "http://example.com", nil)
+	resp, err = NewTransport(base).RoundTrip(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != r {
+		t.Errorf("request without ids should pass through")
+	}
+}
+
+// requestWithID returns an outgoing request whose context carries the request id
+// set by the requestid middleware.
+func requestWithID(ctx context.Context, id string) *http.Request {
+	var out *http.Request
+	h := requestid.RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out, _ = http.NewRequestWithContext(r.Context(), http.MethodGet, "http://example.com", nil)
+	}))
+	in, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	in.Header.Set("X-Request-ID", id)
+	h.ServeHTTP(httptest.NewRecorder(), in)
+	return out
+}
+
+func TestTransportRequestIDHeader(t *testing.T) {
+	tests := map[string]struct {
+		header string
+		want   http.Header
+	}{
+		"custom header": {"X-Correlation-Id", http.Header{"X-Correlation-Id": {"req-123456"}}},
+		"not inject":    {"", http.Header{}},
+	}
+	for name, tt := range tests {
+		var got *http.Request
+		base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			got = req
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})
+		resp, err := NewTransport(base, WithRequestIDHeader(tt.header)).RoundTrip(requestWithID(context.Background(), "req-123456"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if !reflect.DeepEqual(got.Header, tt.want) {
+			t.Errorf("%s: headers = %v, want %v", name, got.Header, tt.want)
+		}
+	}
+}